@@ -8,8 +8,16 @@ import (
 	"gitlab.cern.ch/eos/argeos/internal/server"
 	"gitlab.cern.ch/eos/argeos/pkg/plugin"
 	"gitlab.cern.ch/eos/argeos/pkg/plugin/bash"
+	"gitlab.cern.ch/eos/argeos/pkg/plugin/external"
+	"gitlab.cern.ch/eos/argeos/pkg/plugin/hang"
+	"gitlab.cern.ch/eos/argeos/pkg/plugin/kernel"
+	"gitlab.cern.ch/eos/argeos/pkg/plugin/logtail"
+	"gitlab.cern.ch/eos/argeos/pkg/plugin/memory"
+	"gitlab.cern.ch/eos/argeos/pkg/plugin/mount"
 	"gitlab.cern.ch/eos/argeos/pkg/plugin/network"
 	"gitlab.cern.ch/eos/argeos/pkg/plugin/probe"
+	"gitlab.cern.ch/eos/argeos/pkg/plugin/process"
+	"gitlab.cern.ch/eos/argeos/pkg/plugin/systemd"
 )
 
 func main() {
@@ -23,7 +31,7 @@ func main() {
 	logger.Init(config.CmdLogFile)
 	config := config.ConfigurefromFile(configpath)
 
-	pluginmgr := plugin.NewManager()
+	pluginmgr := plugin.NewManager(config.Server)
 	networkplugin := network.NewPlugin(config)
 	pluginmgr.Register(networkplugin)
 
@@ -33,6 +41,31 @@ func main() {
 	bashplugin := bash.NewPlugin(config)
 	pluginmgr.Register(bashplugin)
 
+	processplugin := process.NewPlugin(config)
+	pluginmgr.Register(processplugin)
+
+	hangplugin := hang.NewPlugin(config)
+	pluginmgr.Register(hangplugin)
+
+	systemdplugin := systemd.NewPlugin(config)
+	pluginmgr.Register(systemdplugin)
+
+	logtailplugin := logtail.NewPlugin(config)
+	pluginmgr.Register(logtailplugin)
+
+	mountplugin := mount.NewPlugin(config)
+	pluginmgr.Register(mountplugin)
+
+	memoryplugin := memory.NewPlugin(config)
+	pluginmgr.Register(memoryplugin)
+
+	kernelplugin := kernel.NewPlugin(config)
+	pluginmgr.Register(kernelplugin)
+
+	for _, externalplugin := range external.NewPlugins(config) {
+		pluginmgr.Register(externalplugin)
+	}
+
 	server := server.NewServer(config.Server, pluginmgr)
 	server.Start()
 }
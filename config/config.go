@@ -15,6 +15,9 @@ type ServerConfig struct {
 	AdminSocket        string `json:"admin_socket"`
 	DiagnosticDir      string `json:"diagnostic_dir"`
 	DiagnosticInterval int32  `json:"diagnostic_interval"`
+	DumpConcurrency    int    `json:"dump_concurrency"` // max plugins dumping at once
+	DumpTimeout        int32  `json:"dump_timeout"`     // per-plugin dump deadline in seconds
+	PanicQuarantine    int    `json:"panic_quarantine"` // panics after which a plugin is no longer called
 	LogLevel           string `json:"log_level"`
 	LogFile            string `json:"log_file"`
 }
@@ -36,6 +39,9 @@ var defaultConfig Config = Config{
 		AdminSocket:        "/var/run/argeos.asok",
 		DiagnosticDir:      "/var/lib/argeos/diagnostics",
 		DiagnosticInterval: 300,
+		DumpConcurrency:    4,
+		DumpTimeout:        300,
+		PanicQuarantine:    3,
 		LogFile:            "/var/log/argeos/argeos.log",
 	},
 }
@@ -53,6 +59,15 @@ func overrideDefaults(config *Config) {
 	if config.Server.DiagnosticInterval == 0 {
 		config.Server.DiagnosticInterval = defaultConfig.Server.DiagnosticInterval
 	}
+	if config.Server.DumpConcurrency <= 0 {
+		config.Server.DumpConcurrency = defaultConfig.Server.DumpConcurrency
+	}
+	if config.Server.DumpTimeout <= 0 {
+		config.Server.DumpTimeout = defaultConfig.Server.DumpTimeout
+	}
+	if config.Server.PanicQuarantine <= 0 {
+		config.Server.PanicQuarantine = defaultConfig.Server.PanicQuarantine
+	}
 }
 
 func Configure(jsonString []byte) Config {
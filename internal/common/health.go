@@ -28,6 +28,29 @@ func HealthStateString(state HealthState) string {
 	}
 }
 
+// severity ranks FAIL above ERROR, a failing component matters more than a
+// plugin that could not check one, and only a FAIL triggers a dump
+func severity(state HealthState) int {
+	switch state {
+	case StateOK:
+		return 0
+	case StateWARN:
+		return 1
+	case StateERROR:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// WorseState returns the more severe of both states, to roll statuses up
+func WorseState(a HealthState, b HealthState) HealthState {
+	if severity(b) > severity(a) {
+		return b
+	}
+	return a
+}
+
 type HealthStatus struct {
 	State       HealthState `json:"state"`
 	StateString string      `json:"state_string"`
@@ -64,3 +87,19 @@ type HealthDaemon interface {
 	HealthCheck() HealthStatus
 	Stop()
 }
+
+// HealthStateFromString is the inverse of HealthStateString
+func HealthStateFromString(state string) (HealthState, bool) {
+	switch state {
+	case "OK":
+		return StateOK, true
+	case "WARN":
+		return StateWARN, true
+	case "ERROR":
+		return StateERROR, true
+	case "FAIL":
+		return StateFAIL, true
+	default:
+		return StateERROR, false
+	}
+}
@@ -0,0 +1,141 @@
+package kmsg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Path is the kernel log device
+var Path = "/dev/kmsg"
+
+// maxRecord is larger than the kernel's record limit, a read with a smaller
+// buffer fails with EINVAL
+const maxRecord = 8192
+
+// Record is one kernel log message as exported by /dev/kmsg
+type Record struct {
+	Level   int // 0 (emerg) to 7 (debug)
+	Seq     uint64
+	Time    time.Duration // since boot
+	Message string
+}
+
+func (r Record) String() string {
+	return fmt.Sprintf("[%12.6f] %s", r.Time.Seconds(), r.Message)
+}
+
+// Parse parses a record like "6,1234,5678901,-;message", dropping the
+// dictionary lines that may follow the message
+func Parse(line string) (Record, error) {
+	prefix, message, found := strings.Cut(line, ";")
+	if !found {
+		return Record{}, fmt.Errorf("malformed kmsg record: %q", line)
+	}
+	fields := strings.Split(prefix, ",")
+	if len(fields) < 3 {
+		return Record{}, fmt.Errorf("malformed kmsg record: %q", line)
+	}
+	priority, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return Record{}, fmt.Errorf("malformed kmsg priority: %q", line)
+	}
+	seq, _ := strconv.ParseUint(fields[1], 10, 64)
+	usec, _ := strconv.ParseInt(fields[2], 10, 64)
+	message, _, _ = strings.Cut(message, "\n")
+	return Record{
+		Level:   priority & 7,
+		Seq:     seq,
+		Time:    time.Duration(usec) * time.Microsecond,
+		Message: message,
+	}, nil
+}
+
+// ReadAll returns the records currently in the kernel ring buffer
+func ReadAll() ([]Record, error) {
+	fd, err := syscall.Open(Path, syscall.O_RDONLY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+
+	records := make([]Record, 0)
+	buf := make([]byte, maxRecord)
+	for {
+		n, err := syscall.Read(fd, buf)
+		if errors.Is(err, syscall.EAGAIN) {
+			return records, nil
+		}
+		if errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.EINTR) {
+			// the records we were about to read got overwritten, reads
+			// continue with the oldest remaining one
+			continue
+		}
+		if err != nil {
+			return records, err
+		}
+		if n == 0 {
+			return records, nil
+		}
+		if record, err := Parse(string(buf[:n])); err == nil {
+			records = append(records, record)
+		}
+	}
+}
+
+// Follow calls handle for every new kernel message until ctx is done, only
+// for messages logged after the call when fromEnd is set
+func Follow(ctx context.Context, fromEnd bool, handle func(Record)) error {
+	// /dev/kmsg is pollable, so reads wait in the runtime poller and closing
+	// the file unblocks them
+	f, err := os.Open(Path)
+	if err != nil {
+		return err
+	}
+	if fromEnd {
+		if _, err := f.Seek(0, io.SeekEnd); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	stop := context.AfterFunc(ctx, func() { f.Close() })
+	defer func() {
+		if stop() {
+			f.Close()
+		}
+	}()
+
+	buf := make([]byte, maxRecord)
+	for {
+		n, err := f.Read(buf)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if errors.Is(err, syscall.EPIPE) {
+			// we fell behind and records got overwritten
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if record, err := Parse(string(buf[:n])); err == nil {
+			handle(record)
+		}
+	}
+}
+
+// Format renders records like dmesg does
+func Format(records []Record) string {
+	var out strings.Builder
+	for _, r := range records {
+		out.WriteString(r.String())
+		out.WriteByte('\n')
+	}
+	return out.String()
+}
@@ -0,0 +1,57 @@
+package kmsg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    Record
+		wantErr bool
+	}{
+		{
+			name: "plain",
+			line: "6,1234,5678901,-;eth0: link up",
+			want: Record{Level: 6, Seq: 1234, Time: 5678901 * time.Microsecond, Message: "eth0: link up"},
+		},
+		{
+			name: "facility bits dropped",
+			line: "11,7,100,-;kernel: error",
+			want: Record{Level: 3, Seq: 7, Time: 100 * time.Microsecond, Message: "kernel: error"},
+		},
+		{
+			name: "dictionary dropped",
+			line: "3,42,2000000,c;sd 0:0:0:0: [sda] I/O error\n SUBSYSTEM=scsi\n DEVICE=+scsi:0:0:0:0",
+			want: Record{Level: 3, Seq: 42, Time: 2 * time.Second, Message: "sd 0:0:0:0: [sda] I/O error"},
+		},
+		{
+			name: "semicolon in message",
+			line: "4,1,1,-;a;b",
+			want: Record{Level: 4, Seq: 1, Time: time.Microsecond, Message: "a;b"},
+		},
+		{name: "no message", line: "6,1,1,-", wantErr: true},
+		{name: "short prefix", line: "6,1;message", wantErr: true},
+		{name: "bad priority", line: "x,1,1,-;message", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordString(t *testing.T) {
+	r := Record{Time: 1500 * time.Millisecond, Message: "hello"}
+	if got := r.String(); got != "[    1.500000] hello" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,84 @@
+package procfs
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Pressure holds one line of a PSI file, the avg fields are percentages
+type Pressure struct {
+	Avg10  float64
+	Avg60  float64
+	Avg300 float64
+	Total  uint64 // microseconds stalled
+}
+
+// ReadPressure parses /proc/pressure/<resource> (cpu, memory or io) into its
+// "some" and "full" lines. cpu only has "full" on recent kernels.
+func ReadPressure(resource string) (map[string]Pressure, error) {
+	data, err := os.ReadFile(filepath.Join(Root, "pressure", resource))
+	if err != nil {
+		return nil, err
+	}
+	pressure := make(map[string]Pressure)
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("malformed pressure line: %q", line)
+		}
+		var p Pressure
+		for _, field := range fields[1:] {
+			key, value, _ := strings.Cut(field, "=")
+			switch key {
+			case "avg10":
+				p.Avg10, _ = strconv.ParseFloat(value, 64)
+			case "avg60":
+				p.Avg60, _ = strconv.ParseFloat(value, 64)
+			case "avg300":
+				p.Avg300, _ = strconv.ParseFloat(value, 64)
+			case "total":
+				p.Total, _ = strconv.ParseUint(value, 10, 64)
+			}
+		}
+		pressure[fields[0]] = p
+	}
+	return pressure, nil
+}
+
+// readKeyValues reads files of "key value [unit]" or "key: value [unit]"
+// lines like meminfo and vmstat
+func readKeyValues(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	values := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		values[strings.TrimSuffix(fields[0], ":")] = value
+	}
+	return values, scanner.Err()
+}
+
+// Meminfo returns /proc/meminfo, values in kB
+func Meminfo() (map[string]uint64, error) {
+	return readKeyValues(filepath.Join(Root, "meminfo"))
+}
+
+// Vmstat returns the counters of /proc/vmstat
+func Vmstat() (map[string]uint64, error) {
+	return readKeyValues(filepath.Join(Root, "vmstat"))
+}
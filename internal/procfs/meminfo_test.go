@@ -0,0 +1,62 @@
+package procfs
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadPressure(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]Pressure
+		wantErr bool
+	}{
+		{
+			name: "some and full",
+			content: "some avg10=1.50 avg60=0.75 avg300=0.10 total=123456\n" +
+				"full avg10=0.50 avg60=0.25 avg300=0.00 total=6543\n",
+			want: map[string]Pressure{
+				"some": {Avg10: 1.5, Avg60: 0.75, Avg300: 0.1, Total: 123456},
+				"full": {Avg10: 0.5, Avg60: 0.25, Total: 6543},
+			},
+		},
+		{
+			name:    "some only, cpu on older kernels",
+			content: "some avg10=12.00 avg60=8.00 avg300=4.00 total=99\n",
+			want:    map[string]Pressure{"some": {Avg10: 12, Avg60: 8, Avg300: 4, Total: 99}},
+		},
+		{name: "missing field", content: "some avg10=1.50 avg60=0.75 total=123456\n", wantErr: true},
+		{name: "empty", content: "", wantErr: true},
+	}
+	root := t.TempDir()
+	defer func(previous string) { Root = previous }(Root)
+	Root = root
+	if err := os.Mkdir(filepath.Join(root, "pressure"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(filepath.Join(root, "pressure", "memory"), []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := ReadPressure("memory")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadPressureMissing(t *testing.T) {
+	defer func(previous string) { Root = previous }(Root)
+	Root = t.TempDir()
+	if _, err := ReadPressure("memory"); !os.IsNotExist(err) {
+		t.Errorf("got %v, want a not exist error", err)
+	}
+}
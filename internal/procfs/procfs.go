@@ -0,0 +1,176 @@
+package procfs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Root is where procfs is mounted
+var Root = "/proc"
+
+func PidPath(pid int, elem ...string) string {
+	return filepath.Join(append([]string{Root, strconv.Itoa(pid)}, elem...)...)
+}
+
+func TaskPath(pid int, tid int, elem ...string) string {
+	return filepath.Join(append([]string{Root, strconv.Itoa(pid), "task", strconv.Itoa(tid)}, elem...)...)
+}
+
+// Pids lists all the processes currently running
+func Pids() ([]int, error) {
+	return listNumeric(Root)
+}
+
+// Threads lists the thread ids of a process
+func Threads(pid int) ([]int, error) {
+	return listNumeric(PidPath(pid, "task"))
+}
+
+func listNumeric(dir string) ([]int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int, 0, len(entries))
+	for _, entry := range entries {
+		id, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// Stat holds the fields of /proc/<pid>/stat we care about
+type Stat struct {
+	Comm      string
+	State     string
+	Utime     uint64 // clock ticks
+	Stime     uint64 // clock ticks
+	StartTime uint64 // clock ticks since boot
+}
+
+// ParseStat parses the content of a stat file. comm is enclosed in
+// parentheses and may itself contain spaces and parentheses.
+func ParseStat(data string) (Stat, error) {
+	open := strings.IndexByte(data, '(')
+	close := strings.LastIndexByte(data, ')')
+	if open < 0 || close < open {
+		return Stat{}, fmt.Errorf("malformed stat: %q", data)
+	}
+	fields := strings.Fields(data[close+1:])
+	// fields[0] is field 3 (state) in proc(5)
+	if len(fields) < 20 {
+		return Stat{}, fmt.Errorf("short stat: %q", data)
+	}
+	stat := Stat{Comm: data[open+1 : close], State: fields[0]}
+	stat.Utime, _ = strconv.ParseUint(fields[11], 10, 64)
+	stat.Stime, _ = strconv.ParseUint(fields[12], 10, 64)
+	stat.StartTime, _ = strconv.ParseUint(fields[19], 10, 64)
+	return stat, nil
+}
+
+func ReadStat(path string) (Stat, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Stat{}, err
+	}
+	return ParseStat(string(data))
+}
+
+func ProcessStat(pid int) (Stat, error) {
+	return ReadStat(PidPath(pid, "stat"))
+}
+
+func ThreadStat(pid int, tid int) (Stat, error) {
+	return ReadStat(TaskPath(pid, tid, "stat"))
+}
+
+// Wchan returns the kernel function the thread is sleeping in, "0" or "" when
+// it is running.
+func Wchan(pid int, tid int) string {
+	data, err := os.ReadFile(TaskPath(pid, tid, "wchan"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// Schedstat returns the time spent on cpu and waiting on a runqueue, in ns,
+// and the number of timeslices run.
+func Schedstat(pid int, tid int) ([3]uint64, error) {
+	var values [3]uint64
+	data, err := os.ReadFile(TaskPath(pid, tid, "schedstat"))
+	if err != nil {
+		return values, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return values, fmt.Errorf("malformed schedstat: %q", data)
+	}
+	for i := range values {
+		values[i], _ = strconv.ParseUint(fields[i], 10, 64)
+	}
+	return values, nil
+}
+
+// Cmdline returns the argv of the process
+func Cmdline(pid int) ([]string, error) {
+	data, err := os.ReadFile(PidPath(pid, "cmdline"))
+	if err != nil {
+		return nil, err
+	}
+	return strings.FieldsFunc(string(data), func(r rune) bool { return r == 0 }), nil
+}
+
+func Comm(pid int) (string, error) {
+	data, err := os.ReadFile(PidPath(pid, "comm"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// StatusField returns a field of /proc/<pid>/status, like "VmRSS"
+func StatusField(pid int, field string) (string, error) {
+	data, err := os.ReadFile(PidPath(pid, "status"))
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, found := strings.Cut(line, ":")
+		if found && key == field {
+			return strings.TrimSpace(value), nil
+		}
+	}
+	return "", fmt.Errorf("field %s not found", field)
+}
+
+// Fd is an open file descriptor and the target of its symlink
+type Fd struct {
+	Fd     int
+	Target string
+}
+
+func Fds(pid int) ([]Fd, error) {
+	fds, err := listNumeric(PidPath(pid, "fd"))
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Fd, 0, len(fds))
+	for _, fd := range fds {
+		target, err := os.Readlink(PidPath(pid, "fd", strconv.Itoa(fd)))
+		if err != nil {
+			// closed in the meantime
+			continue
+		}
+		result = append(result, Fd{Fd: fd, Target: target})
+	}
+	return result, nil
+}
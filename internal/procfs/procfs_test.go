@@ -0,0 +1,45 @@
+package procfs
+
+import "testing"
+
+func TestParseStat(t *testing.T) {
+	// state ppid pgrp session tty tpgid flags minflt cminflt majflt cmajflt
+	// utime stime cutime cstime priority nice threads itrealvalue starttime vsize
+	const rest = " S 1 1234 1234 0 -1 4194560 100 0 0 0 250 120 0 0 20 0 33 0 98765 1000000\n"
+	tests := []struct {
+		name    string
+		data    string
+		want    Stat
+		wantErr bool
+	}{
+		{
+			name: "plain comm",
+			data: "1234 (xrootd)" + rest,
+			want: Stat{Comm: "xrootd", State: "S", Utime: 250, Stime: 120, StartTime: 98765},
+		},
+		{
+			name: "comm with spaces",
+			data: "1234 (eos fst io)" + rest,
+			want: Stat{Comm: "eos fst io", State: "S", Utime: 250, Stime: 120, StartTime: 98765},
+		},
+		{
+			name: "comm with parentheses",
+			data: "1234 (a) D 1 (b))" + rest,
+			want: Stat{Comm: "a) D 1 (b)", State: "S", Utime: 250, Stime: 120, StartTime: 98765},
+		},
+		{name: "truncated", data: "1234 (xrootd) S 1 1234 1234 0 -1 4194560", wantErr: true},
+		{name: "no comm", data: "1234 xrootd" + rest, wantErr: true},
+		{name: "empty", data: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseStat(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
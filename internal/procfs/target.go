@@ -0,0 +1,92 @@
+package procfs
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Target selects the processes a plugin looks at. Exactly one of Process,
+// Pidfile or SystemdUnit is expected; Cmdline narrows a Process match down,
+// e.g. to tell the MGM and FST xrootd processes apart.
+type Target struct {
+	Name        string `json:"name"`
+	Process     string `json:"process"`
+	Cmdline     string `json:"cmdline"`
+	Pidfile     string `json:"pidfile"`
+	SystemdUnit string `json:"systemd_unit"`
+}
+
+// Systemctl is the systemctl binary used to resolve systemd units
+var Systemctl = "systemctl"
+
+// Resolve returns the pids currently matching the target
+func (t Target) Resolve() ([]int, error) {
+	switch {
+	case t.Pidfile != "":
+		return t.resolvePidfile()
+	case t.SystemdUnit != "":
+		return t.resolveUnit()
+	case t.Process != "":
+		return t.resolveProcess()
+	default:
+		return nil, fmt.Errorf("target %s: no process, pidfile or systemd_unit configured", t.Name)
+	}
+}
+
+func (t Target) resolvePidfile() ([]int, error) {
+	data, err := os.ReadFile(t.Pidfile)
+	if err != nil {
+		return nil, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("target %s: invalid pidfile %s: %w", t.Name, t.Pidfile, err)
+	}
+	if _, err := os.Stat(PidPath(pid)); err != nil {
+		return nil, fmt.Errorf("target %s: stale pidfile %s, pid %d not running", t.Name, t.Pidfile, pid)
+	}
+	return []int{pid}, nil
+}
+
+func (t Target) resolveUnit() ([]int, error) {
+	out, err := exec.Command(Systemctl, "show", "--property=MainPID", "--value", t.SystemdUnit).Output()
+	if err != nil {
+		return nil, fmt.Errorf("target %s: systemctl show %s: %w", t.Name, t.SystemdUnit, err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil {
+		return nil, fmt.Errorf("target %s: unexpected MainPID %q", t.Name, out)
+	}
+	if pid == 0 {
+		return nil, nil
+	}
+	return []int{pid}, nil
+}
+
+func (t Target) resolveProcess() ([]int, error) {
+	pids, err := Pids()
+	if err != nil {
+		return nil, err
+	}
+	matches := make([]int, 0)
+	for _, pid := range pids {
+		cmdline, err := Cmdline(pid)
+		if err != nil || len(cmdline) == 0 {
+			// kernel threads have an empty cmdline
+			continue
+		}
+		comm, _ := Comm(pid)
+		if comm != t.Process && filepath.Base(cmdline[0]) != t.Process {
+			continue
+		}
+		if t.Cmdline != "" && !strings.Contains(strings.Join(cmdline, " "), t.Cmdline) {
+			continue
+		}
+		matches = append(matches, pid)
+	}
+	return matches, nil
+}
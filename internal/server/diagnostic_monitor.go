@@ -17,7 +17,7 @@ type DiagnosticMonitor struct {
 	interval          time.Duration
 	monitoringPlugins []common.HealthDaemon
 	healthUpdate      chan common.HealthStatus
-	consecutiveFails  int
+	failing           map[string]int // consecutive FAILs by component
 	backOffDuration   time.Duration
 	maxBackOff        time.Duration
 }
@@ -29,14 +29,14 @@ func NewDiagnosticMonitor(cfg config.ServerConfig, pluginMgr *plugin.PluginManag
 		interval:          time.Duration(cfg.DiagnosticInterval) * time.Second,
 		monitoringPlugins: make([]common.HealthDaemon, 0),
 		healthUpdate:      make(chan common.HealthStatus, 100),
-		consecutiveFails:  0,
+		failing:           make(map[string]int),
 		backOffDuration:   1 * time.Second,
 		maxBackOff:        1800 * time.Second,
 	}
 }
 
 func (dm *DiagnosticMonitor) RegisterMonitoringPlugin(plugin common.HealthDaemon) {
-	logger.Logger.Info("Registering monitoring plugin", "plugin", plugin.Name())
+	logger.Logger.Info("Registering monitoring plugin", "plugin", dm.PluginMgr.PluginName(plugin))
 	dm.monitoringPlugins = append(dm.monitoringPlugins, plugin)
 }
 
@@ -53,13 +53,83 @@ func (dm *DiagnosticMonitor) StartTicker(ctx context.Context) {
 		case <-ticker.C:
 			logger.Logger.Debug("Running periodic health check")
 			for _, mp := range dm.monitoringPlugins {
-				update := mp.HealthCheck()
-				dm.healthUpdate <- update
+				name := dm.PluginMgr.PluginName(mp)
+				dm.healthUpdate <- named(dm.PluginMgr.SafeHealthCheck(name, mp.HealthCheck), name)
 			}
 		}
 	}
 }
 
+// named gives statuses sent without a name the name of the plugin, for both
+// the ticker and the Start stream, so that the OK of a component clears its
+// FAIL whichever way they came.
+func named(update common.HealthStatus, name string) common.HealthStatus {
+	if update.Name == "" {
+		return update.WithComponent(name)
+	}
+	return update
+}
+
+// forwardUpdates passes the statuses sent by the plugin's Start on to the
+// monitor, named. It outlives restarts of Start, which may leave goroutines
+// behind still sending.
+func (dm *DiagnosticMonitor) forwardUpdates(ctx context.Context, name string, updates <-chan common.HealthStatus) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case update := <-updates:
+			dm.healthUpdate <- named(update, name)
+		}
+	}
+}
+
+// runMonitoringPlugin runs the plugin's Start, restarting it with a backoff
+// when it panics or returns an error, until the plugin gets quarantined.
+// Start returning nil means the plugin has nothing to monitor.
+func (dm *DiagnosticMonitor) runMonitoringPlugin(ctx context.Context, p common.HealthDaemon) {
+	name := dm.PluginMgr.PluginName(p)
+	updates := make(chan common.HealthStatus)
+	go dm.forwardUpdates(ctx, name, updates)
+
+	delay := time.Second
+	for {
+		started := time.Now()
+		var startErr error
+		err := dm.PluginMgr.SafeCall(name, "start", func() {
+			startErr = p.Start(ctx, updates)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil && startErr == nil {
+			return
+		}
+		if err == nil {
+			err = startErr
+			logger.Logger.Error("Error starting monitoring plugin", "plugin", name, "error", startErr)
+		}
+
+		dm.healthUpdate <- common.HealthERROR(err.Error()).WithComponent(name)
+		if _, quarantined := err.(*plugin.QuarantineError); quarantined {
+			logger.Logger.Error("Not restarting quarantined monitoring plugin", "plugin", name)
+			return
+		}
+		// a plugin that ran for a while before failing starts over from the
+		// shortest delay
+		if time.Since(started) > time.Minute {
+			delay = time.Second
+		}
+		logger.Logger.Warn("Restarting monitoring plugin", "plugin", name, "error", err, "delay", delay)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, dm.maxBackOff)
+	}
+}
+
 func (dm *DiagnosticMonitor) Start(wg *sync.WaitGroup, ctx context.Context) {
 	defer wg.Done()
 	logger.Logger.Info("Starting Diagnostic Monitor")
@@ -68,17 +138,12 @@ func (dm *DiagnosticMonitor) Start(wg *sync.WaitGroup, ctx context.Context) {
 		if mp, ok := plugin.(common.HealthDaemon); ok {
 			dm.RegisterMonitoringPlugin(mp)
 		} else {
-			logger.Logger.Debug("Plugin does not implement HealthDaemon interface", "plugin", plugin.Name())
+			logger.Logger.Debug("Plugin does not implement HealthDaemon interface", "plugin", dm.PluginMgr.PluginName(plugin))
 		}
 	}
 
 	for _, mp := range dm.monitoringPlugins {
-		go func(p common.HealthDaemon) {
-			if err := p.Start(ctx, dm.healthUpdate); err != nil {
-				logger.Logger.Error("Error starting monitoring plugin", "plugin", p.Name(), "error", err)
-			}
-
-		}(mp)
+		go dm.runMonitoringPlugin(ctx, mp)
 	}
 
 	go func() {
@@ -90,27 +155,31 @@ func (dm *DiagnosticMonitor) Start(wg *sync.WaitGroup, ctx context.Context) {
 			case <-ctx.Done():
 				logger.Logger.Info("Stopping Diagnostic Monitor")
 				for _, mp := range dm.monitoringPlugins {
-					mp.Stop()
+					dm.PluginMgr.SafeCall(dm.PluginMgr.PluginName(mp), "stop", mp.Stop)
 				}
 				return
 			case update := <-dm.healthUpdate:
 				logger.Logger.Debug("Received health update", "plugin", update.Name, "status", update.StateString)
+				// FAILs are tracked per component, so that an OK from one
+				// component does not cancel the dump for another one failing
 				if update.State == common.StateFAIL {
-					dm.consecutiveFails++
+					dm.failing[update.Name]++
 					if !isBackingOff {
 						isBackingOff = true
-						delay := min(dm.backOffDuration*time.Duration(dm.consecutiveFails), dm.maxBackOff)
+						delay := min(dm.backOffDuration*time.Duration(dm.failing[update.Name]), dm.maxBackOff)
 						backoffTimer = time.NewTimer(delay)
-						logger.Logger.Warn("Health check failed", "plugin", update.Name, "consecutiveFails", dm.consecutiveFails, "backoff", delay)
+						logger.Logger.Warn("Health check failed", "plugin", update.Name, "consecutiveFails", dm.failing[update.Name], "backoff", delay)
 					}
 				} else if update.State == common.StateOK {
 					logger.Logger.Debug("Health check OK", "plugin", update.Name)
-					dm.consecutiveFails = 0
-					isBackingOff = false
-					if backoffTimer != nil && !backoffTimer.Stop() {
-						<-backoffTimer.C // Drain the channel
+					delete(dm.failing, update.Name)
+					if len(dm.failing) == 0 {
+						isBackingOff = false
+						if backoffTimer != nil && !backoffTimer.Stop() {
+							<-backoffTimer.C // Drain the channel
+						}
+						backoffTimer = nil
 					}
-					backoffTimer = nil
 				}
 				// ensure that we don't evaluate a nil backoffTimer
 			case <-func() <-chan time.Time {
@@ -120,7 +189,7 @@ func (dm *DiagnosticMonitor) Start(wg *sync.WaitGroup, ctx context.Context) {
 				return nil
 			}():
 				if isBackingOff {
-					logger.Logger.Info("Dumping diagnostics after backoff", "consecutiveFails", dm.consecutiveFails)
+					logger.Logger.Info("Dumping diagnostics after backoff", "failing", len(dm.failing))
 					dm.PluginMgr.DiagnosticDump(dm.Cfg.DiagnosticDir)
 					dm.backOffDuration = min(dm.backOffDuration*2, dm.maxBackOff)
 					isBackingOff = false
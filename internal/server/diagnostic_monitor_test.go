@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"gitlab.cern.ch/eos/argeos/config"
+	"gitlab.cern.ch/eos/argeos/internal/common"
+	"gitlab.cern.ch/eos/argeos/internal/logger"
+	"gitlab.cern.ch/eos/argeos/pkg/plugin"
+)
+
+func TestMain(m *testing.M) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	os.Exit(m.Run())
+}
+
+// flakyDaemon fails to start the first time, then streams an unnamed FAIL
+type flakyDaemon struct {
+	starts int
+}
+
+func (d *flakyDaemon) Name() string                     { return "flaky" }
+func (d *flakyDaemon) HealthCheck() common.HealthStatus { return common.HealthOK("") }
+func (d *flakyDaemon) Stop()                            {}
+
+func (d *flakyDaemon) Start(ctx context.Context, updates chan<- common.HealthStatus) error {
+	d.starts++
+	if d.starts == 1 {
+		return errors.New("no kmsg")
+	}
+	updates <- common.HealthFAIL("stuck")
+	<-ctx.Done()
+	return nil
+}
+
+func TestRunMonitoringPlugin(t *testing.T) {
+	pm := plugin.NewManager(config.ServerConfig{})
+	dm := NewDiagnosticMonitor(config.ServerConfig{}, pm)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dm.runMonitoringPlugin(ctx, &flakyDaemon{})
+
+	for _, want := range []common.HealthStatus{
+		common.HealthERROR("no kmsg").WithComponent("flaky"),
+		common.HealthFAIL("stuck").WithComponent("flaky"),
+	} {
+		select {
+		case got := <-dm.healthUpdate:
+			if got.State != want.State || got.Name != want.Name || got.Detail != want.Detail {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no update, want %+v", want)
+		}
+	}
+}
+
+func TestNamed(t *testing.T) {
+	if got := named(common.HealthFAIL("stuck"), "probe"); got.Name != "probe" {
+		t.Errorf("unnamed status got name %q, want probe", got.Name)
+	}
+	if got := named(common.HealthFAIL("stuck").WithComponent("probe/eos"), "probe"); got.Name != "probe/eos" {
+		t.Errorf("component renamed to %q", got.Name)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"fmt"
 	"net"
 	"os"
 	"os/signal"
@@ -154,6 +155,8 @@ func (srv *Server) Start() {
 		cancel()
 	}()
 
+	srv.PluginMgr.Start(ctx)
+
 	wg.Add(1)
 	go srv.DiagnosticMonitor.Start(&wg, ctx)
 
@@ -167,6 +170,22 @@ func (srv *Server) Start() {
 	logger.Logger.Info("Server shutdown complete!")
 }
 
+// builtinCommands are handled by the server itself rather than by a plugin
+var builtinCommands = map[string]plugin.Command{
+	"healthcheck": {Description: "Run the health check of all plugins, as JSON"},
+	"help": {Description: "Describe the supported commands", Args: []plugin.Arg{
+		{Name: "format", Type: plugin.ArgString, Description: "--json or --text to describe the commands, a JSON list of their names otherwise"},
+		{Name: "command", Type: plugin.ArgString, Description: "Only describe this command"},
+	}},
+	"diagnostic_dump": {Description: "Run the diagnostic dump of all plugins into the diagnostic dir"},
+	"release": {Description: "Release a plugin quarantined after repeated panics", Args: []plugin.Arg{
+		{Name: "plugin", Type: plugin.ArgString, Required: true, Description: "Name of the plugin"},
+	}},
+	"debug": {Description: "Set the log level", Args: []plugin.Arg{
+		{Name: "level", Type: plugin.ArgString, Required: true, Description: "One of debug, info, warn, error"},
+	}},
+}
+
 func (srv *Server) setLogLevel(args ...string) string {
 	if len(args) == 0 {
 		return "No log level provided, use debug <level>"
@@ -176,16 +195,60 @@ func (srv *Server) setLogLevel(args ...string) string {
 
 }
 
+// help answers with JSON unless --text is asked for. Without arguments it
+// keeps answering the JSON list of command names, which clients parse.
+func (srv *Server) help(args ...string) string {
+	asText := false
+	if len(args) > 0 && (args[0] == "--json" || args[0] == "--text") {
+		asText = args[0] == "--text"
+		args = args[1:]
+	} else if len(args) == 0 {
+		return plugin.RenderCommandNames(srv.PluginMgr.Commands())
+	}
+
+	commands := make([]plugin.CommandInfo, 0, len(builtinCommands))
+	for _, name := range []string{"debug", "diagnostic_dump", "healthcheck", "help", "release"} {
+		commands = append(commands, plugin.CommandInfo{Plugin: "argeos", Name: name, Command: builtinCommands[name]})
+	}
+	commands = append(commands, srv.PluginMgr.Commands()...)
+
+	if len(args) > 0 {
+		filtered := make([]plugin.CommandInfo, 0)
+		for _, info := range commands {
+			if info.Name == args[0] {
+				filtered = append(filtered, info)
+			}
+		}
+		if len(filtered) == 0 {
+			return fmt.Sprintf("Command %s not supported", args[0])
+		}
+		commands = filtered
+	}
+
+	if asText {
+		return plugin.RenderHelpText(commands)
+	}
+	return plugin.RenderHelpJSON(commands)
+}
+
 func (srv *Server) handleCommand(command string, args ...string) string {
+	if schema, ok := builtinCommands[command]; ok {
+		if _, err := schema.Validate(args); err != nil {
+			return fmt.Sprintf("Invalid arguments for %s: %s, usage: %s %s", command, err, command, schema.Usage())
+		}
+	}
+
 	switch command {
 	case "healthcheck":
 		return srv.HealthCheck()
 	case "help":
-		return srv.PluginMgr.SupportedCommands()
+		return srv.help(args...)
 	case "diagnostic_dump":
 		return srv.PluginMgr.DiagnosticDump(srv.Cfg.DiagnosticDir)
 	case "debug":
 		return srv.setLogLevel(args...)
+	case "release":
+		return srv.PluginMgr.Release(args[0])
 	default:
 		return srv.PluginMgr.ExecuteCommand(command, args...)
 	}
@@ -1,13 +1,16 @@
 package bash
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"gitlab.cern.ch/eos/argeos/config"
 	"gitlab.cern.ch/eos/argeos/internal/common"
@@ -15,17 +18,46 @@ import (
 	"gitlab.cern.ch/eos/argeos/pkg/plugin"
 )
 
+// PluginConfig HealthInterval is the number of seconds between runs of the
+// health scripts. ScriptTimeout bounds each script without a timeout header
+// and DumpTimeout all the scripts of a dump, both in seconds. DumpTimeout
+// defaults to less than the server dump_timeout, so that the results of the
+// scripts that completed still make it into the dump. Concurrency is the
+// number of dump scripts of the same order run at once. Sandbox applies to
+// all scripts, and Scripts overrides it for scripts by name. Manifest lists
+// the SHA-256 of the scripts allowed to run, signed by ManifestKey or root
+// owned without a key. Verified scripts run from copies in VerifiedDir.
 type PluginConfig struct {
-	ScriptDir string            `json:"script_dir"`
-	EnvVars   map[string]string `json:"env_vars"`
+	ScriptDir      string                   `json:"script_dir"`
+	EnvVars        map[string]string        `json:"env_vars"`
+	HealthInterval int32                    `json:"health_interval"`
+	ScriptTimeout  int32                    `json:"script_timeout"`
+	DumpTimeout    int32                    `json:"dump_timeout"`
+	Concurrency    int                      `json:"concurrency"`
+	Sandbox        SandboxConfig            `json:"sandbox"`
+	Scripts        map[string]SandboxConfig `json:"scripts"`
+	Manifest       string                   `json:"manifest"`
+	ManifestKey    string                   `json:"manifest_key"`
+	VerifiedDir    string                   `json:"verified_dir"`
 }
 
-const DefaultScriptDir = "/usr/share/argeos/scripts"
+const (
+	DefaultScriptDir      = "/usr/share/argeos/scripts"
+	DefaultHealthInterval = 60
+	DefaultScriptTimeout  = 60
+	DefaultDumpTimeout    = 240
+	// next to the diagnostics, /tmp is often mounted noexec
+	DefaultVerifiedDir = "/var/lib/argeos/verified"
+)
 
 type BashPlugin struct {
 	name        string
-	commandHelp map[string]string
+	commandHelp map[string]plugin.Command
 	config      PluginConfig
+
+	mu      sync.Mutex // guards health
+	health  []common.HealthStatus
+	checked time.Time
 }
 
 func extractConfig(cfg config.Config) PluginConfig {
@@ -49,11 +81,35 @@ func extractConfig(cfg config.Config) PluginConfig {
 
 func NewPlugin(cfg config.Config) plugin.Plugin {
 	bash_cfg := extractConfig(cfg)
+	if bash_cfg.ScriptDir == "" {
+		bash_cfg.ScriptDir = DefaultScriptDir
+	}
+	if bash_cfg.HealthInterval <= 0 {
+		bash_cfg.HealthInterval = DefaultHealthInterval
+	}
+	if bash_cfg.ScriptTimeout <= 0 {
+		bash_cfg.ScriptTimeout = DefaultScriptTimeout
+	}
+	if bash_cfg.DumpTimeout <= 0 {
+		bash_cfg.DumpTimeout = DefaultDumpTimeout
+	}
+	if bash_cfg.VerifiedDir == "" {
+		bash_cfg.VerifiedDir = DefaultVerifiedDir
+	}
+	if bash_cfg.Concurrency <= 0 {
+		bash_cfg.Concurrency = 1
+	}
 	return &BashPlugin{
 		name: "bash",
-		commandHelp: map[string]string{
-			"run_script":      "Run a bash script",
-			"diagnostic_dump": "Run all diagnostic scripts",
+		commandHelp: map[string]plugin.Command{
+			"run_script": {Description: "Run a single script of the script directory", Args: []plugin.Arg{
+				{Name: "script", Type: plugin.ArgString, Required: true, Description: "Name of the script, as shown by list_scripts"},
+				{Name: "args", Type: plugin.ArgString, Variadic: true, Description: "Arguments passed to the script"},
+			}},
+			"list_scripts": {Description: "List the scripts of the script directory and their metadata", Args: []plugin.Arg{
+				{Name: "format", Type: plugin.ArgString, Description: "--json for JSON output, text otherwise"},
+			}},
+			"diagnostic_dump": {Description: "Run all diagnostic scripts, as shown by list_scripts", Args: []plugin.Arg{plugin.DumpDirArg}},
 		},
 		config: bash_cfg,
 	}
@@ -63,18 +119,24 @@ func (bp *BashPlugin) Name() string {
 	return bp.name
 }
 
-func (bp *BashPlugin) CommandHelp() map[string]string {
+// CommandHelp is static, it gets called for every command. list_scripts
+// shows the scripts and their descriptions.
+func (bp *BashPlugin) CommandHelp() map[string]plugin.Command {
 	return bp.commandHelp
 }
 
-func (bp *BashPlugin) getScripts() ([]string, error) {
-	files, err := os.ReadDir(bp.config.ScriptDir)
+// healthDir is the subdirectory of the script directory holding health
+// check scripts
+const healthDir = "health"
+
+// readScriptDir reads the executables of a directory with their metadata
+func readScriptDir(dir string) ([]Script, error) {
+	files, err := os.ReadDir(dir)
 	if err != nil {
-		logger.Logger.Error("Error reading script directory", "error", err)
 		return nil, err
 	}
 
-	scripts := make([]string, 0, len(files))
+	scripts := make([]Script, 0, len(files))
 	for _, file := range files {
 
 		if file.IsDir() {
@@ -91,47 +153,152 @@ func (bp *BashPlugin) getScripts() ([]string, error) {
 			logger.Logger.Info("Skipping non-executable file", "file", file.Name(), "permissions", fileinfo.Mode().String())
 			continue
 		}
-		scripts = append(scripts, file.Name())
+		script, err := readScript(file.Name(), filepath.Join(dir, file.Name()))
+		if err != nil {
+			logger.Logger.Error("Error reading script header", "file", file.Name(), "error", err)
+			continue
+		}
+		scripts = append(scripts, script)
+	}
+	return scripts, nil
+}
+
+// getScripts returns the executables of the script directory and of its
+// health subdirectory with their metadata, by order and then lexically like
+// unix tools
+func (bp *BashPlugin) getScripts() ([]Script, error) {
+	scripts, err := readScriptDir(bp.config.ScriptDir)
+	if err != nil {
+		logger.Logger.Error("Error reading script directory", "error", err)
+		return nil, err
+	}
+
+	healthScripts, err := readScriptDir(filepath.Join(bp.config.ScriptDir, healthDir))
+	if err != nil && !os.IsNotExist(err) {
+		logger.Logger.Error("Error reading health script directory", "error", err)
+	}
+	names := make(map[string]bool, len(scripts))
+	for _, script := range scripts {
+		names[script.Name] = true
+	}
+	for _, script := range healthScripts {
+		if names[script.Name] {
+			logger.Logger.Warn("Skipping health script shadowed by a script of the same name", "script", script.Name)
+			continue
+		}
+		script.Phase = PhaseHealth
+		scripts = append(scripts, script)
 	}
-	sort.Strings(scripts) // sort lexically like unix tools
+
+	sort.SliceStable(scripts, func(i, j int) bool {
+		if scripts[i].Order != scripts[j].Order {
+			return scripts[i].Order < scripts[j].Order
+		}
+		return scripts[i].Name < scripts[j].Name
+	})
 	return scripts, nil
 }
 
-func (bp *BashPlugin) runScripts(script_env []string) (string, error) {
-	files, err := bp.getScripts()
-	if err != nil || len(files) == 0 {
+// findScript looks a script up by name among the discovered ones, so that
+// only files of the script directory itself can be run
+func (bp *BashPlugin) findScript(name string) (Script, error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return Script{}, fmt.Errorf("invalid script name %q", name)
+	}
+	scripts, err := bp.getScripts()
+	if err != nil {
+		return Script{}, err
+	}
+	for _, script := range scripts {
+		if script.Name == name {
+			return script, nil
+		}
+	}
+	return Script{}, fmt.Errorf("unknown script %s", name)
+}
+
+// runOne runs a script with arguments. Its DUMP_DIR is a temporary
+// directory, kept and reported only when the script wrote to it.
+func (bp *BashPlugin) runOne(name string, args []string) (string, error) {
+	script, err := bp.findScript(name)
+	if err != nil {
 		return "", err
 	}
+	if len(args) < len(script.Args) {
+		return "", fmt.Errorf("usage: %s", script.Usage())
+	}
 
-	var output strings.Builder
+	dumpDir, err := os.MkdirTemp("", "argeos-"+script.Name+"-")
+	if err != nil {
+		return "", err
+	}
+	if err := bp.chownForScript(script, dumpDir); err != nil {
+		os.Remove(dumpDir)
+		return "", err
+	}
+	logger.Logger.Info("Running script", "script", script.Name, "args", args)
+	var out bytes.Buffer
+	err = bp.runScript(context.Background(), script, []string{fmt.Sprintf("DUMP_DIR=%s", dumpDir)}, &out, &out, args...)
+	if entries, _ := os.ReadDir(dumpDir); len(entries) == 0 {
+		os.Remove(dumpDir)
+	} else {
+		fmt.Fprintf(&out, "\nDUMP_DIR: %s\n", dumpDir)
+	}
+	if err != nil {
+		return out.String(), fmt.Errorf("script %s failed: %w", script.Name, err)
+	}
+	return out.String(), nil
+}
 
-	logger.Logger.Debug("Running scripts", "scripts", files)
-	for _, file := range files {
-		cmd := exec.Command(filepath.Join(bp.config.ScriptDir, file))
-		cmd.Env = append(os.Environ(), script_env...)
-		out, err := cmd.CombinedOutput()
+func (bp *BashPlugin) listScripts(format string) (string, error) {
+	scripts, err := bp.getScripts()
+	if err != nil {
+		return "", err
+	}
+	if format == "--json" {
+		out, err := json.MarshalIndent(scripts, "", "  ")
+		return string(out), err
+	}
 
-		if err != nil {
-			logger.Logger.Error("Error running script", "script", file, "error", err)
-			output.WriteString(fmt.Sprintf("Error running script %s: %s\n", file, err))
+	var out strings.Builder
+	for _, script := range scripts {
+		fmt.Fprintf(&out, "%s\n", script.Usage())
+		if script.Description != "" {
+			fmt.Fprintf(&out, "    %s\n", script.Description)
+		}
+		fmt.Fprintf(&out, "    phase=%s", script.Phase)
+		if script.Order != unordered {
+			fmt.Fprintf(&out, " order=%d", script.Order)
+		}
+		if script.Timeout > 0 {
+			fmt.Fprintf(&out, " timeout=%ds", script.Timeout)
 		}
-		output.WriteString(fmt.Sprintf("=== Running %s ===\n%s\n", file, string(out)))
+		if script.User != "" {
+			fmt.Fprintf(&out, " user=%s", script.User)
+		}
+		out.WriteByte('\n')
 	}
-	return output.String(), nil
+	return out.String(), nil
 }
 
 func (bp *BashPlugin) Execute(command string, args ...string) (string, error) {
 	switch command {
 	case "run_script":
-		fallthrough
+		if len(args) < 1 {
+			return "", fmt.Errorf("no script name provided")
+		}
+		return bp.runOne(args[0], args[1:])
+	case "list_scripts":
+		format := ""
+		if len(args) > 0 {
+			format = args[0]
+		}
+		return bp.listScripts(format)
 	case "diagnostic_dump":
 		if len(args) < 1 {
 			return "", fmt.Errorf("no diagnostic directory provided")
 		}
-		scriptEnv := []string{
-			fmt.Sprintf("DUMP_DIR=%s", args[0]),
-		}
-		return bp.runScripts(scriptEnv)
+		return bp.runScripts(args[0])
 	default:
 		return "", fmt.Errorf("command not implemented")
 	}
@@ -150,5 +317,34 @@ func (bp *BashPlugin) HealthCheck() common.HealthStatus {
 	if len(filelist) == 0 {
 		return common.HealthWARN("No scripts found in script directory")
 	}
-	return common.HealthOK("Bash plugin is healthy")
+
+	// the health scripts make up the plugin health, the worst of them wins
+	worst := common.HealthOK("Bash plugin is healthy")
+	problems := make([]string, 0)
+	for _, status := range bp.ComponentHealth() {
+		if common.WorseState(worst.State, status.State) != worst.State {
+			worst.State = status.State
+			worst.StateString = status.StateString
+		}
+		if status.State != common.StateOK {
+			problems = append(problems, fmt.Sprintf("%s: %s", status.Name, status.Detail))
+		}
+	}
+
+	// refused health scripts are already reported by their component
+	others := make([]Script, 0, len(filelist))
+	for _, script := range filelist {
+		if script.Phase != PhaseHealth {
+			others = append(others, script)
+		}
+	}
+	if refused := bp.refusedScripts(others); len(refused) > 0 {
+		worst.State = common.WorseState(worst.State, common.StateWARN)
+		worst.StateString = common.HealthStateString(worst.State)
+		problems = append(problems, refused...)
+	}
+	if len(problems) > 0 {
+		worst.Detail = strings.Join(problems, "; ")
+	}
+	return worst
 }
@@ -0,0 +1,180 @@
+package bash
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"gitlab.cern.ch/eos/argeos/internal/logger"
+)
+
+const (
+	StatusOK      = "ok"
+	StatusFailed  = "failed"  // exited non zero or killed by a signal
+	StatusTimeout = "timeout" // killed at its deadline
+	StatusSkipped = "skipped" // not started, the dump deadline had passed
+	StatusError   = "error"   // could not be started
+	StatusRefused = "refused" // not in the manifest or modified
+)
+
+// Result is the outcome of a script of a dump, as written to results.json.
+// ExitCode is -1 when the script did not exit by itself.
+type Result struct {
+	Script   string    `json:"script"`
+	Status   string    `json:"status"`
+	ExitCode int       `json:"exit_code"`
+	Signal   string    `json:"signal,omitempty"`
+	Start    time.Time `json:"start"`
+	Duration float64   `json:"duration"` // seconds
+	Error    string    `json:"error,omitempty"`
+}
+
+func (r *Result) setError(err error) {
+	r.Status = StatusOK
+	if err == nil {
+		return
+	}
+	r.ExitCode = -1
+	r.Error = err.Error()
+
+	var exitErr *exec.ExitError
+	var timeoutErr *TimeoutError
+	var integrityErr *IntegrityError
+	switch {
+	case errors.As(err, &integrityErr):
+		r.Status = StatusRefused
+	case errors.As(err, &timeoutErr):
+		r.Status = StatusTimeout
+		r.Signal = syscall.SIGKILL.String()
+	case errors.As(err, &exitErr):
+		r.Status = StatusFailed
+		r.ExitCode = exitErr.ExitCode()
+		if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			r.Signal = ws.Signal().String()
+		}
+	default:
+		r.Status = StatusError
+	}
+}
+
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// dumpScript runs a script of the dump, its stdout and stderr going to
+// files of <dump>/bash/<script>/ along with its result.json
+func (bp *BashPlugin) dumpScript(ctx context.Context, script Script, dumpDir string, bashDir string) Result {
+	result := Result{Script: script.Name, Start: time.Now()}
+	scriptDir := filepath.Join(bashDir, script.Name)
+	err := os.MkdirAll(scriptDir, 0755)
+	if err == nil {
+		err = bp.chownForScript(script, scriptDir)
+	}
+	var stdout, stderr *os.File
+	if err == nil {
+		stdout, err = os.Create(filepath.Join(scriptDir, "stdout"))
+	}
+	if err == nil {
+		defer stdout.Close()
+		stderr, err = os.Create(filepath.Join(scriptDir, "stderr"))
+	}
+	if err == nil {
+		defer stderr.Close()
+		scriptEnv := []string{
+			fmt.Sprintf("DUMP_DIR=%s", dumpDir),
+			fmt.Sprintf("SCRIPT_DUMP_DIR=%s", scriptDir),
+		}
+		err = bp.runScript(ctx, script, scriptEnv, stdout, stderr)
+	}
+	result.Duration = time.Since(result.Start).Seconds()
+	result.setError(err)
+	if err != nil {
+		logger.Logger.Error("Error running script", "script", script.Name, "status", result.Status, "error", err)
+	}
+	if err := writeJSON(filepath.Join(scriptDir, "result.json"), result); err != nil {
+		logger.Logger.Error("Error writing script result", "script", script.Name, "error", err)
+	}
+	return result
+}
+
+// runScripts runs the dump scripts, writing their output under <dump>/bash
+// with a results.json summing up all of them
+func (bp *BashPlugin) runScripts(dumpDir string) (string, error) {
+	scripts, err := bp.getScripts()
+	if err != nil || len(scripts) == 0 {
+		return "", err
+	}
+	bashDir := filepath.Join(dumpDir, "bash")
+	if err := os.MkdirAll(bashDir, 0755); err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(bp.config.DumpTimeout)*time.Second)
+	defer cancel()
+
+	dumpScripts := make([]Script, 0, len(scripts))
+	for _, script := range scripts {
+		if script.Phase != PhaseDump {
+			continue
+		}
+		if len(script.Args) > 0 {
+			logger.Logger.Debug("Skipping script needing arguments", "script", script.Name, "args", script.Args)
+			continue
+		}
+		dumpScripts = append(dumpScripts, script)
+	}
+
+	// scripts of the same order run concurrently, up to Concurrency at a
+	// time, and each order group only starts once the previous one is done.
+	// Results stay in script order.
+	results := make([]Result, len(dumpScripts))
+	sem := make(chan struct{}, bp.config.Concurrency)
+	logger.Logger.Debug("Running scripts", "scripts", len(dumpScripts), "concurrency", bp.config.Concurrency)
+	for start := 0; start < len(dumpScripts); {
+		end := start
+		for end < len(dumpScripts) && dumpScripts[end].Order == dumpScripts[start].Order {
+			end++
+		}
+		var wg sync.WaitGroup
+		for i := start; i < end; i++ {
+			wg.Add(1)
+			go func(i int, script Script) {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				if ctx.Err() != nil {
+					results[i] = Result{Script: script.Name, Status: StatusSkipped, ExitCode: -1, Start: time.Now(),
+						Error: fmt.Sprintf("dump_timeout of %ds exceeded", bp.config.DumpTimeout)}
+					return
+				}
+				results[i] = bp.dumpScript(ctx, script, dumpDir, bashDir)
+			}(i, dumpScripts[i])
+		}
+		wg.Wait()
+		start = end
+	}
+
+	if err := writeJSON(filepath.Join(bashDir, "results.json"), results); err != nil {
+		return "", err
+	}
+	counts := make(map[string]int)
+	for _, result := range results {
+		counts[result.Status]++
+	}
+	summary := fmt.Sprintf("bash: ran %d scripts, %d failed, %d timed out, %d skipped",
+		len(results)-counts[StatusSkipped]-counts[StatusRefused], counts[StatusFailed]+counts[StatusError], counts[StatusTimeout], counts[StatusSkipped])
+	if counts[StatusRefused] > 0 {
+		summary += fmt.Sprintf(", %d refused", counts[StatusRefused])
+	}
+	return summary, nil
+}
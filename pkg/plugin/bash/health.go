@@ -0,0 +1,132 @@
+package bash
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"gitlab.cern.ch/eos/argeos/internal/common"
+	"gitlab.cern.ch/eos/argeos/internal/logger"
+)
+
+// nagiosStates maps the exit codes of Nagios plugins, anything else is an
+// ERROR
+var nagiosStates = map[int]common.HealthState{
+	0: common.StateOK,
+	1: common.StateWARN,
+	2: common.StateFAIL,
+	3: common.StateERROR, // UNKNOWN
+}
+
+// nagiosDetail is the first line of the output without the performance
+// data following "|"
+func nagiosDetail(stdout []byte) string {
+	line, _, _ := strings.Cut(string(stdout), "\n")
+	line, _, _ = strings.Cut(line, "|")
+	return strings.TrimSpace(line)
+}
+
+func (bp *BashPlugin) runHealthScript(script Script) common.HealthStatus {
+	var stdout, stderr bytes.Buffer
+	err := bp.runScript(context.Background(), script, nil, &stdout, &stderr)
+	detail := nagiosDetail(stdout.Bytes())
+
+	state := common.StateOK
+	var exitErr *exec.ExitError
+	var integrityErr *IntegrityError
+	switch {
+	case errors.As(err, &exitErr):
+		var known bool
+		if state, known = nagiosStates[exitErr.ExitCode()]; !known {
+			state = common.StateERROR
+		}
+		if detail == "" {
+			detail = exitErr.Error()
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				detail = fmt.Sprintf("%s: %s", detail, msg)
+			}
+		}
+	case errors.As(err, &integrityErr):
+		state = common.StateWARN
+		detail = err.Error()
+	case err != nil:
+		state = common.StateERROR
+		detail = err.Error()
+	}
+	return common.HealthStatus{
+		State:       state,
+		StateString: common.HealthStateString(state),
+		Name:        script.Name,
+		Detail:      detail,
+	}
+}
+
+// checkScripts runs the health scripts and remembers their statuses
+func (bp *BashPlugin) checkScripts() []common.HealthStatus {
+	scripts, err := bp.getScripts()
+	if err != nil {
+		return nil
+	}
+	statuses := make([]common.HealthStatus, 0)
+	for _, script := range scripts {
+		if script.Phase != PhaseHealth {
+			continue
+		}
+		if len(script.Args) > 0 {
+			logger.Logger.Warn("Skipping health script needing arguments", "script", script.Name, "args", script.Args)
+			continue
+		}
+		statuses = append(statuses, bp.runHealthScript(script))
+	}
+
+	bp.mu.Lock()
+	bp.health = statuses
+	bp.checked = time.Now()
+	bp.mu.Unlock()
+	return statuses
+}
+
+// ComponentHealth reports each health script as its own component, reusing
+// the statuses of the last run when it is recent enough
+func (bp *BashPlugin) ComponentHealth() []common.HealthStatus {
+	bp.mu.Lock()
+	fresh := time.Since(bp.checked) < time.Duration(bp.config.HealthInterval)*time.Second
+	statuses := bp.health
+	bp.mu.Unlock()
+	if fresh {
+		return statuses
+	}
+	return bp.checkScripts()
+}
+
+// Start runs the health scripts every HealthInterval, reporting the scripts
+// whose state changed
+func (bp *BashPlugin) Start(ctx context.Context, updateChannel chan<- common.HealthStatus) error {
+	interval := time.Duration(bp.config.HealthInterval) * time.Second
+	logger.Logger.Info("Starting bash health scripts", "interval", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	previous := make(map[string]common.HealthState)
+	for {
+		for _, status := range bp.checkScripts() {
+			if previous[status.Name] != status.State {
+				updateChannel <- status.WithComponent(bp.name + "/" + status.Name)
+			}
+			previous[status.Name] = status.State
+		}
+		select {
+		case <-ctx.Done():
+			logger.Logger.Info("Bash health scripts stopped")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (bp *BashPlugin) Stop() {
+	logger.Logger.Info("Stopping bash health scripts")
+}
@@ -0,0 +1,272 @@
+package bash
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// signatureSuffix names the detached signature of the manifest
+const signatureSuffix = ".sig"
+
+// IntegrityError is returned for scripts that are not in the manifest or do
+// not match their hash there
+type IntegrityError struct {
+	Script string
+	Reason string
+}
+
+func (e *IntegrityError) Error() string {
+	return fmt.Sprintf("refusing to run %s: %s", e.Script, e.Reason)
+}
+
+// parseManifest reads sha256sum style lines, "<hash>  <name>", names being
+// relative to the script directory like health/check_fuse.sh
+func parseManifest(data []byte) (map[string]string, error) {
+	hashes := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hash, name, ok := strings.Cut(line, " ")
+		name = strings.TrimPrefix(strings.TrimSpace(name), "*")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("line %d: expected <sha256> <name>", n)
+		}
+		if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("line %d: invalid sha256 %q", n, hash)
+		}
+		hashes[filepath.Clean(name)] = strings.ToLower(hash)
+	}
+	return hashes, scanner.Err()
+}
+
+// checkRootOwned makes sure only root can have changed the file
+func checkRootOwned(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st.Uid != 0 {
+		return fmt.Errorf("%s is not owned by root", path)
+	}
+	if info.Mode().Perm()&0022 != 0 {
+		return fmt.Errorf("%s is writable by group or others, mode %s", path, info.Mode().Perm())
+	}
+	return nil
+}
+
+// verifySignature checks the detached ed25519 signature of the manifest
+// against the PEM public key, as made by
+// openssl pkeyutl -sign -rawin -inkey key.pem -in manifest -out manifest.sig
+func verifySignature(data []byte, signaturePath string, keyPath string) error {
+	if err := checkRootOwned(keyPath); err != nil {
+		return err
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return err
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return fmt.Errorf("%s: no PEM public key", keyPath)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("%s: %w", keyPath, err)
+	}
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return fmt.Errorf("%s: not an ed25519 key", keyPath)
+	}
+	signature, err := os.ReadFile(signaturePath)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(edKey, data, signature) {
+		return fmt.Errorf("bad signature %s", signaturePath)
+	}
+	return nil
+}
+
+// loadManifest reads the manifest, trusted when signed by ManifestKey or,
+// without a key, when it is root owned. It is read again on every use, so
+// that updates of the scripts and the manifest apply without a restart.
+func (bp *BashPlugin) loadManifest() (map[string]string, error) {
+	data, err := os.ReadFile(bp.config.Manifest)
+	if err != nil {
+		return nil, err
+	}
+	if bp.config.ManifestKey != "" {
+		err = verifySignature(data, bp.config.Manifest+signatureSuffix, bp.config.ManifestKey)
+	} else {
+		err = checkRootOwned(bp.config.Manifest)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseManifest(data)
+}
+
+func fileHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// expectedHash looks the script up in the manifest, by its path relative to
+// the script directory
+func (bp *BashPlugin) expectedHash(script Script, hashes map[string]string) (string, error) {
+	name, err := filepath.Rel(bp.config.ScriptDir, script.Path)
+	if err != nil {
+		name = script.Name
+	}
+	expected, known := hashes[name]
+	if !known {
+		return "", &IntegrityError{Script: script.Name, Reason: "not in the manifest"}
+	}
+	return expected, nil
+}
+
+func modifiedError(script Script) error {
+	return &IntegrityError{Script: script.Name, Reason: "modified, sha256 does not match the manifest"}
+}
+
+// verifyScript checks a script against the manifest, to report the scripts
+// that would be refused
+func (bp *BashPlugin) verifyScript(script Script, hashes map[string]string) error {
+	expected, err := bp.expectedHash(script, hashes)
+	if err != nil {
+		return err
+	}
+	hash, err := fileHash(script.Path)
+	if err != nil {
+		return &IntegrityError{Script: script.Name, Reason: err.Error()}
+	}
+	if hash != expected {
+		return modifiedError(script)
+	}
+	return nil
+}
+
+// verifiedDir creates the directory holding the copies of verified scripts,
+// which must not be writable by anyone but root
+func verifiedDir(path string) error {
+	if err := os.MkdirAll(path, 0711); err != nil {
+		return err
+	}
+	return checkRootOwned(path)
+}
+
+// verifiedScript returns the script to run. With a manifest, the script is
+// hashed from a single descriptor while being copied to a private directory
+// under VerifiedDir, and that copy is what runs: replacing the file in
+// script_dir after it was hashed has no effect. An unreadable or untrusted
+// manifest refuses every script. cleanup removes the copy once the script is
+// done.
+func (bp *BashPlugin) verifiedScript(script Script) (verified Script, cleanup func(), err error) {
+	cleanup = func() {}
+	if bp.config.Manifest == "" {
+		return script, cleanup, nil
+	}
+	hashes, err := bp.loadManifest()
+	if err != nil {
+		return script, cleanup, &IntegrityError{Script: script.Name, Reason: fmt.Sprintf("manifest: %s", err)}
+	}
+	expected, err := bp.expectedHash(script, hashes)
+	if err != nil {
+		return script, cleanup, err
+	}
+	if err := verifiedDir(bp.config.VerifiedDir); err != nil {
+		return script, cleanup, &IntegrityError{Script: script.Name, Reason: fmt.Sprintf("verified_dir: %s", err)}
+	}
+
+	src, err := os.Open(script.Path)
+	if err != nil {
+		return script, cleanup, &IntegrityError{Script: script.Name, Reason: err.Error()}
+	}
+	defer src.Close()
+	// only we can write to the directory, the 0711 mode lets the sandbox user
+	// run the copy without listing the directory
+	dir, err := os.MkdirTemp(bp.config.VerifiedDir, "run-")
+	if err != nil {
+		return script, cleanup, err
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+	if err := os.Chmod(dir, 0711); err != nil {
+		cleanup()
+		return script, func() {}, err
+	}
+	verified = script
+	verified.Path = filepath.Join(dir, filepath.Base(script.Path))
+	if err := copyHashed(src, verified.Path, expected); err != nil {
+		cleanup()
+		if err == errHashMismatch {
+			err = modifiedError(script)
+		}
+		return script, func() {}, err
+	}
+	return verified, cleanup, nil
+}
+
+var errHashMismatch = errors.New("sha256 mismatch")
+
+// copyHashed copies src to a new read only executable at path, failing with
+// errHashMismatch when the content copied does not have the expected hash
+func copyHashed(src io.Reader, path string, expected string) error {
+	dst, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0555)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(dst, h), src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != expected {
+		return errHashMismatch
+	}
+	return nil
+}
+
+// refusedScripts returns why each of the scripts would be refused
+func (bp *BashPlugin) refusedScripts(scripts []Script) []string {
+	if bp.config.Manifest == "" {
+		return nil
+	}
+	hashes, err := bp.loadManifest()
+	if err != nil {
+		return []string{fmt.Sprintf("refusing to run any script, manifest: %s", err)}
+	}
+	refused := make([]string, 0)
+	for _, script := range scripts {
+		if err := bp.verifyScript(script, hashes); err != nil {
+			refused = append(refused, err.Error())
+		}
+	}
+	return refused
+}
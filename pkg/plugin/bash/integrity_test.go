@@ -0,0 +1,158 @@
+package bash
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	helloHash = "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03" // "hello\n"
+	emptyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+func TestParseManifest(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "sha256sum output",
+			data: helloHash + "  10-a.sh\n" + emptyHash + " *health/check.sh\n",
+			want: map[string]string{"10-a.sh": helloHash, "health/check.sh": emptyHash},
+		},
+		{
+			name: "comments, blank lines and upper case",
+			data: "# scripts of the fuse clients\n\n" + strings.ToUpper(helloHash) + "  ./10-a.sh\n",
+			want: map[string]string{"10-a.sh": helloHash},
+		},
+		{name: "empty", data: "", want: map[string]string{}},
+		{name: "no name", data: helloHash + "\n", wantErr: true},
+		{name: "short hash", data: "abcd  10-a.sh\n", wantErr: true},
+		{name: "not hex", data: strings.Repeat("z", 64) + "  10-a.sh\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseManifest([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCopyHashed(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "copy")
+	if err := copyHashed(strings.NewReader("hello\n"), path, helloHash); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "hello\n" {
+		t.Errorf("copy holds %q, %v", data, err)
+	}
+
+	err := copyHashed(strings.NewReader("tampered\n"), filepath.Join(dir, "tampered"), helloHash)
+	if !errors.Is(err, errHashMismatch) {
+		t.Errorf("got %v, want errHashMismatch", err)
+	}
+	if err := copyHashed(strings.NewReader("hello\n"), path, helloHash); err == nil {
+		t.Error("overwrote an existing file")
+	}
+}
+
+func TestVerifiedScriptWithoutManifest(t *testing.T) {
+	bp := &BashPlugin{config: PluginConfig{ScriptDir: t.TempDir()}}
+	script := Script{Name: "10-a.sh", Path: filepath.Join(bp.config.ScriptDir, "10-a.sh")}
+	verified, cleanup, err := bp.verifiedScript(script)
+	defer cleanup()
+	if err != nil || verified.Path != script.Path {
+		t.Errorf("got %+v, %v, want the script itself", verified, err)
+	}
+}
+
+func TestVerifiedScriptUntrustedManifest(t *testing.T) {
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "manifest")
+	if err := os.WriteFile(manifest, []byte(helloHash+"  10-a.sh\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// whatever the owner, a world writable manifest is not trusted
+	if err := os.Chmod(manifest, 0666); err != nil {
+		t.Fatal(err)
+	}
+	bp := &BashPlugin{config: PluginConfig{ScriptDir: dir, Manifest: manifest}}
+	_, cleanup, err := bp.verifiedScript(Script{Name: "10-a.sh", Path: filepath.Join(dir, "10-a.sh")})
+	defer cleanup()
+	var integrityErr *IntegrityError
+	if !errors.As(err, &integrityErr) {
+		t.Errorf("got %v, want an IntegrityError", err)
+	}
+}
+
+func TestVerifiedScript(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("the manifest has to be owned by root")
+	}
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "manifest")
+	if err := os.WriteFile(manifest, []byte(helloHash+"  10-a.sh\n"+helloHash+"  20-b.sh\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	scripts := map[string]string{"10-a.sh": "hello\n", "20-b.sh": "tampered\n", "30-c.sh": "hello\n"}
+	for name, content := range scripts {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	verifiedDir := filepath.Join(t.TempDir(), "verified")
+	bp := &BashPlugin{config: PluginConfig{ScriptDir: dir, Manifest: manifest, VerifiedDir: verifiedDir}}
+
+	script := Script{Name: "10-a.sh", Path: filepath.Join(dir, "10-a.sh")}
+	verified, cleanup, err := bp.verifiedScript(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(filepath.Dir(verified.Path)) != verifiedDir || filepath.Base(verified.Path) != "10-a.sh" {
+		t.Errorf("runs %s, not a private copy in %s", verified.Path, verifiedDir)
+	}
+	if data, err := os.ReadFile(verified.Path); err != nil || string(data) != "hello\n" {
+		t.Errorf("copy holds %q, %v", data, err)
+	}
+	cleanup()
+	if _, err := os.Stat(filepath.Dir(verified.Path)); !os.IsNotExist(err) {
+		t.Errorf("copy not cleaned up: %v", err)
+	}
+	if _, err := os.Stat(verifiedDir); err != nil {
+		t.Errorf("verified_dir removed: %v", err)
+	}
+
+	// a verified_dir others can write to refuses every script
+	if err := os.Chmod(verifiedDir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	_, cleanup, err = bp.verifiedScript(script)
+	cleanup()
+	if err == nil || !strings.Contains(err.Error(), "verified_dir") {
+		t.Errorf("got %v, want the verified_dir refused", err)
+	}
+	if err := os.Chmod(verifiedDir, 0711); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"20-b.sh", "30-c.sh"} {
+		_, cleanup, err := bp.verifiedScript(Script{Name: name, Path: filepath.Join(dir, name)})
+		cleanup()
+		var integrityErr *IntegrityError
+		if !errors.As(err, &integrityErr) {
+			t.Errorf("%s: got %v, want an IntegrityError", name, err)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package bash
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gitlab.cern.ch/eos/argeos/internal/logger"
+)
+
+const (
+	PhaseDump     = "dump"      // run on every diagnostic dump
+	PhaseHealth   = "health"    // run as a health check
+	PhaseOnDemand = "on-demand" // only run with run_script
+)
+
+// metadataPrefix starts the header comments scripts describe themselves
+// with, like:
+//
+//	#!/bin/bash
+//	# argeos-description: Collect the fuse client statistics
+//	# argeos-phase: dump
+//	# argeos-timeout: 60
+//	# argeos-args: mountpoint
+//	# argeos-user: daemon
+//	# argeos-order: 20
+const metadataPrefix = "argeos-"
+
+// only the leading comments are looked at, up to this many lines
+const maxHeaderLines = 64
+
+// unordered scripts run after all the ones with an order, lexically
+const unordered = math.MaxInt32
+
+// Script is an executable of the script directory and the metadata of its
+// header. Timeout is in seconds, zero uses the plugin default.
+type Script struct {
+	Name        string   `json:"name"`
+	Path        string   `json:"path"`
+	Description string   `json:"description,omitempty"`
+	Phase       string   `json:"phase"`
+	Timeout     int32    `json:"timeout,omitempty"`
+	Args        []string `json:"args,omitempty"`
+	User        string   `json:"user,omitempty"`
+	Order       int      `json:"order"`
+}
+
+// numericPrefix returns the order given by a name like 10-collect.sh
+func numericPrefix(name string) int {
+	end := strings.IndexFunc(name, func(r rune) bool { return !unicode.IsDigit(r) })
+	if end == 0 {
+		return unordered
+	}
+	if end < 0 {
+		end = len(name)
+	}
+	order, err := strconv.Atoi(name[:end])
+	if err != nil {
+		return unordered
+	}
+	return order
+}
+
+func (s *Script) setMetadata(key string, value string) error {
+	switch key {
+	case "description":
+		s.Description = value
+	case "phase":
+		switch value {
+		case PhaseDump, PhaseHealth, PhaseOnDemand:
+			s.Phase = value
+		default:
+			return fmt.Errorf("unknown phase %q", value)
+		}
+	case "timeout":
+		timeout, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid timeout %q", value)
+		}
+		s.Timeout = int32(timeout)
+	case "args":
+		s.Args = strings.Fields(value)
+	case "user":
+		s.User = value
+	case "order":
+		order, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid order %q", value)
+		}
+		s.Order = order
+	default:
+		return fmt.Errorf("unknown metadata %q", key)
+	}
+	return nil
+}
+
+// readScript parses the metadata of the leading comment block of a script.
+// Invalid metadata is logged and ignored, so that a typo does not disable a
+// script.
+func readScript(name string, path string) (Script, error) {
+	script := Script{Name: name, Path: path, Phase: PhaseDump, Order: numericPrefix(name)}
+	f, err := os.Open(path)
+	if err != nil {
+		return script, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for i := 0; i < maxHeaderLines && scanner.Scan(); i++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+		comment := strings.TrimSpace(strings.TrimPrefix(line, "#"))
+		entry, found := strings.CutPrefix(comment, metadataPrefix)
+		if !found {
+			continue
+		}
+		key, value, found := strings.Cut(entry, ":")
+		if !found {
+			logger.Logger.Warn("Ignoring malformed script metadata", "script", name, "line", line)
+			continue
+		}
+		if err := script.setMetadata(strings.TrimSpace(key), strings.TrimSpace(value)); err != nil {
+			logger.Logger.Warn("Ignoring invalid script metadata", "script", name, "error", err)
+		}
+	}
+	// a line longer than the scanner buffer, e.g. in a compiled executable,
+	// cannot hold metadata and ends the header
+	if err := scanner.Err(); err != nil && !errors.Is(err, bufio.ErrTooLong) {
+		return script, err
+	}
+	return script, nil
+}
+
+func (s Script) Usage() string {
+	usage := s.Name
+	for _, arg := range s.Args {
+		usage += " <" + arg + ">"
+	}
+	return usage
+}
@@ -0,0 +1,131 @@
+package bash
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gitlab.cern.ch/eos/argeos/internal/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	os.Exit(m.Run())
+}
+
+func TestNumericPrefix(t *testing.T) {
+	tests := []struct {
+		name string
+		want int
+	}{
+		{"10-collect.sh", 10},
+		{"005_early.sh", 5},
+		{"42", 42},
+		{"collect.sh", unordered},
+		{"-10.sh", unordered},
+		{"99999999999999999999-huge.sh", unordered},
+	}
+	for _, tt := range tests {
+		if got := numericPrefix(tt.name); got != tt.want {
+			t.Errorf("numericPrefix(%q) = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReadScript(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    Script
+	}{
+		{
+			name:    "no metadata",
+			file:    "20-plain.sh",
+			content: "#!/bin/bash\necho hello\n",
+			want:    Script{Phase: PhaseDump, Order: 20},
+		},
+		{
+			name: "all metadata",
+			file: "fuse.sh",
+			content: "#!/bin/bash\n" +
+				"# argeos-description: Collect the fuse client statistics\n" +
+				"# argeos-phase: on-demand\n" +
+				"#argeos-timeout: 30\n" +
+				"# argeos-args: mountpoint  fsid\n" +
+				"# argeos-user: daemon\n" +
+				"# argeos-order: 5\n",
+			want: Script{Description: "Collect the fuse client statistics", Phase: PhaseOnDemand,
+				Timeout: 30, Args: []string{"mountpoint", "fsid"}, User: "daemon", Order: 5},
+		},
+		{
+			name: "invalid metadata ignored",
+			file: "10-typo.sh",
+			content: "#!/bin/bash\n" +
+				"# argeos-phase: sometimes\n" +
+				"# argeos-timeout: -1\n" +
+				"# argeos-colour: blue\n" +
+				"# argeos-description\n" +
+				"# argeos-description: still read\n",
+			want: Script{Description: "still read", Phase: PhaseDump, Order: 10},
+		},
+		{
+			name: "only the leading comments",
+			file: "late.sh",
+			content: "#!/bin/bash\n\n# argeos-phase: health\n" +
+				"echo start\n" +
+				"# argeos-description: too late\n",
+			want: Script{Phase: PhaseHealth, Order: unordered},
+		},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0755); err != nil {
+				t.Fatal(err)
+			}
+			got, err := readScript(tt.file, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.want.Name, tt.want.Path = tt.file, path
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadScriptMissing(t *testing.T) {
+	if _, err := readScript("gone.sh", filepath.Join(t.TempDir(), "gone.sh")); !os.IsNotExist(err) {
+		t.Errorf("got %v, want a not exist error", err)
+	}
+}
+
+func TestReadScriptLongLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{name: "binary", content: "\x7fELF" + strings.Repeat("\x00", 100<<10), want: nil},
+		{name: "long line past the header", content: "#!/bin/sh\n# argeos-args: pid\necho " + strings.Repeat("x", 100<<10) + "\n", want: []string{"pid"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "10-tool")
+			if err := os.WriteFile(path, []byte(tt.content), 0755); err != nil {
+				t.Fatal(err)
+			}
+			got, err := readScript("10-tool", path)
+			if err != nil || !reflect.DeepEqual(got.Args, tt.want) {
+				t.Errorf("got %v, %v, want %v", got.Args, err, tt.want)
+			}
+		})
+	}
+}
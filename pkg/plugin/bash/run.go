@@ -0,0 +1,84 @@
+package bash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// killGrace is how long we wait for the output pipes to close after killing
+// a script, in case it left children outside of its process group
+const killGrace = 5 * time.Second
+
+// TimeoutError is returned for scripts killed at their deadline
+type TimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s, process group killed", e.Timeout)
+}
+
+func (bp *BashPlugin) scriptTimeout(script Script) time.Duration {
+	if script.Timeout > 0 {
+		return time.Duration(script.Timeout) * time.Second
+	}
+	return time.Duration(bp.config.ScriptTimeout) * time.Second
+}
+
+// runScript runs the script in its own process group, so that the whole
+// group, with whatever the script started, can be killed when the script
+// outlives its timeout or ctx. SCRIPT_DIR is the directory of the script,
+// since $0 points to the verified copy with a manifest.
+func (bp *BashPlugin) runScript(ctx context.Context, script Script, script_env []string, stdout io.Writer, stderr io.Writer, args ...string) error {
+	timeout := bp.scriptTimeout(script)
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = min(timeout, time.Until(deadline))
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	sc := bp.sandboxConfig(script)
+	script_env = append(script_env[:len(script_env):len(script_env)], "SCRIPT_DIR="+filepath.Dir(script.Path))
+	script, cleanup, err := bp.verifiedScript(script)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	cred, u, err := credential(sc)
+	if err != nil {
+		return fmt.Errorf("cannot run as user %q group %q: %w", sc.User, sc.Group, err)
+	}
+	name, cmdArgs := command(sc, script, args)
+	cmd := exec.CommandContext(ctx, name, cmdArgs...)
+	cmd.Env = bp.environment(u, script_env)
+	cmd.Dir = sc.WorkDir
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Credential: cred}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = killGrace
+	if sc.OutputMB > 0 {
+		limit := &outputLimit{remaining: sc.OutputMB << 20}
+		unlimited := stderr
+		stdout, stderr = limit.writer(stdout), limit.writer(stderr)
+		defer func() {
+			if limit.truncated {
+				fmt.Fprintf(unlimited, "\nargeos: output truncated at %dMB\n", sc.OutputMB)
+			}
+		}()
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err = cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &TimeoutError{Timeout: timeout.Round(time.Second)}
+	}
+	return err
+}
@@ -0,0 +1,207 @@
+package bash
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// SandboxConfig restricts what scripts can do. User and Group are the
+// account to run as, WorkDir the working directory. CPUTime is in seconds,
+// MemoryMB bounds the address space and OutputMB both the stdout and stderr
+// kept and the size of the files a script writes. Zero values leave the
+// limit unset.
+type SandboxConfig struct {
+	User      string `json:"user"`
+	Group     string `json:"group"`
+	WorkDir   string `json:"work_dir"`
+	CPUTime   int64  `json:"cpu_time"`
+	MemoryMB  int64  `json:"memory_mb"`
+	OpenFiles int64  `json:"open_files"`
+	OutputMB  int64  `json:"output_mb"`
+}
+
+const (
+	DefaultWorkDir = "/"
+	sandboxPath    = "/usr/sbin:/usr/bin:/sbin:/bin"
+	// limitShell applies the rlimits before exec'ing the script, Go has no
+	// way to set them on the child only
+	limitShell = "/bin/bash"
+)
+
+// merge returns sc with the fields set in other overriding its own
+func (sc SandboxConfig) merge(other SandboxConfig) SandboxConfig {
+	if other.User != "" {
+		sc.User = other.User
+	}
+	if other.Group != "" {
+		sc.Group = other.Group
+	}
+	if other.WorkDir != "" {
+		sc.WorkDir = other.WorkDir
+	}
+	if other.CPUTime > 0 {
+		sc.CPUTime = other.CPUTime
+	}
+	if other.MemoryMB > 0 {
+		sc.MemoryMB = other.MemoryMB
+	}
+	if other.OpenFiles > 0 {
+		sc.OpenFiles = other.OpenFiles
+	}
+	if other.OutputMB > 0 {
+		sc.OutputMB = other.OutputMB
+	}
+	return sc
+}
+
+// sandboxConfig is the user of the script header, overridden by the plugin
+// sandbox and then by the configuration of the script. The header comes from
+// the script itself, so it must never win over what the admin configured.
+func (bp *BashPlugin) sandboxConfig(script Script) SandboxConfig {
+	sc := SandboxConfig{User: script.User}.merge(bp.config.Sandbox)
+	sc = sc.merge(bp.config.Scripts[script.Name])
+	if sc.WorkDir == "" {
+		sc.WorkDir = DefaultWorkDir
+	}
+	return sc
+}
+
+// credential looks up the uid and gid to run a script as, nil when running
+// as argeos' own user. Group overrides the primary group of User, and the
+// supplementary groups are dropped.
+func credential(sc SandboxConfig) (*syscall.Credential, *user.User, error) {
+	if sc.User == "" && sc.Group == "" {
+		return nil, nil, nil
+	}
+	cred := &syscall.Credential{Uid: uint32(os.Getuid()), Gid: uint32(os.Getgid())}
+	var u *user.User
+	if sc.User != "" {
+		var err error
+		if u, err = user.Lookup(sc.User); err != nil {
+			return nil, nil, err
+		}
+		uid, err := strconv.ParseUint(u.Uid, 10, 32)
+		if err != nil {
+			return nil, nil, err
+		}
+		gid, err := strconv.ParseUint(u.Gid, 10, 32)
+		if err != nil {
+			return nil, nil, err
+		}
+		cred.Uid, cred.Gid = uint32(uid), uint32(gid)
+	}
+	if sc.Group != "" {
+		g, err := user.LookupGroup(sc.Group)
+		if err != nil {
+			return nil, nil, err
+		}
+		gid, err := strconv.ParseUint(g.Gid, 10, 32)
+		if err != nil {
+			return nil, nil, err
+		}
+		cred.Gid = uint32(gid)
+	}
+	return cred, u, nil
+}
+
+// environment is a minimal environment for the script, instead of the one
+// of argeos, followed by the configured env_vars and then script_env
+func (bp *BashPlugin) environment(u *user.User, script_env []string) []string {
+	env := []string{"PATH=" + sandboxPath, "LANG=C"}
+	if u != nil {
+		env = append(env, "HOME="+u.HomeDir, "USER="+u.Username, "LOGNAME="+u.Username)
+	} else {
+		env = append(env, "HOME=/")
+	}
+	names := make([]string, 0, len(bp.config.EnvVars))
+	for name := range bp.config.EnvVars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		env = append(env, fmt.Sprintf("%s=%s", name, bp.config.EnvVars[name]))
+	}
+	return append(env, script_env...)
+}
+
+// ulimits returns the bash ulimit options for the limits of sc
+func ulimits(sc SandboxConfig) []string {
+	var limits []string
+	if sc.CPUTime > 0 {
+		limits = append(limits, fmt.Sprintf("-t %d", sc.CPUTime))
+	}
+	if sc.MemoryMB > 0 {
+		limits = append(limits, fmt.Sprintf("-v %d", sc.MemoryMB*1024))
+	}
+	if sc.OpenFiles > 0 {
+		limits = append(limits, fmt.Sprintf("-n %d", sc.OpenFiles))
+	}
+	if sc.OutputMB > 0 {
+		limits = append(limits, fmt.Sprintf("-f %d", sc.OutputMB*1024))
+	}
+	return limits
+}
+
+// command returns the program and arguments running the script, wrapped in
+// a shell setting its rlimits when it has any. ulimit sets both the soft and
+// the hard limit, so the script cannot raise them again.
+func command(sc SandboxConfig, script Script, args []string) (string, []string) {
+	limits := ulimits(sc)
+	if len(limits) == 0 {
+		return script.Path, args
+	}
+	shell := fmt.Sprintf(`ulimit %s && exec "$@"`, strings.Join(limits, " "))
+	return limitShell, append([]string{"-c", shell, script.Name, script.Path}, args...)
+}
+
+// outputLimit caps the output kept from a script, shared by its stdout and
+// stderr which are copied concurrently. Output past the limit is discarded
+// rather than failing the write, so the script is not killed by SIGPIPE.
+type outputLimit struct {
+	mu        sync.Mutex
+	remaining int64
+	truncated bool
+}
+
+type limitWriter struct {
+	limit *outputLimit
+	w     io.Writer
+}
+
+func (lw *limitWriter) Write(p []byte) (int, error) {
+	lw.limit.mu.Lock()
+	defer lw.limit.mu.Unlock()
+	n := int64(len(p))
+	if n > lw.limit.remaining {
+		n = lw.limit.remaining
+		lw.limit.truncated = true
+	}
+	lw.limit.remaining -= n
+	if n > 0 {
+		if _, err := lw.w.Write(p[:n]); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (ol *outputLimit) writer(w io.Writer) io.Writer {
+	return &limitWriter{limit: ol, w: w}
+}
+
+// chownForScript gives a directory the script writes to, like its
+// SCRIPT_DUMP_DIR, to the user the script runs as
+func (bp *BashPlugin) chownForScript(script Script, dir string) error {
+	cred, _, err := credential(bp.sandboxConfig(script))
+	if err != nil || cred == nil {
+		return err
+	}
+	return os.Chown(dir, int(cred.Uid), int(cred.Gid))
+}
@@ -0,0 +1,179 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Argument types understood by Command.Validate
+const (
+	ArgString   = "string"
+	ArgInt      = "int"
+	ArgBool     = "bool"
+	ArgDuration = "duration"
+	ArgPath     = "path"
+)
+
+// Arg describes a positional command argument. Only the last argument of a
+// command may be variadic, it then takes all the remaining arguments.
+type Arg struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Required    bool   `json:"required"`
+	Default     string `json:"default,omitempty"`
+	Variadic    bool   `json:"variadic,omitempty"`
+	Description string `json:"description"`
+}
+
+// DumpDirArg is the argument every diagnostic_dump command receives
+var DumpDirArg = Arg{Name: "dump_dir", Type: ArgPath, Required: true, Description: "Directory to write the diagnostics to"}
+
+type Command struct {
+	Description string `json:"description"`
+	Args        []Arg  `json:"args,omitempty"`
+}
+
+// UnmarshalJSON also accepts a plain description string, for commands
+// without arguments.
+func (c *Command) UnmarshalJSON(data []byte) error {
+	var description string
+	if err := json.Unmarshal(data, &description); err == nil {
+		*c = Command{Description: description}
+		return nil
+	}
+	type command Command
+	return json.Unmarshal(data, (*command)(c))
+}
+
+func checkArgType(arg Arg, value string) error {
+	var err error
+	switch arg.Type {
+	case ArgInt:
+		_, err = strconv.Atoi(value)
+	case ArgBool:
+		_, err = strconv.ParseBool(value)
+	case ArgDuration:
+		_, err = time.ParseDuration(value)
+	case ArgPath:
+		if value == "" {
+			err = fmt.Errorf("empty path")
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("argument %s: invalid %s %q", arg.Name, arg.Type, value)
+	}
+	return nil
+}
+
+// Validate checks the arguments against the schema and returns them with the
+// defaults of missing optional arguments filled in.
+func (c Command) Validate(args []string) ([]string, error) {
+	validated := make([]string, 0, max(len(args), len(c.Args)))
+	for i, arg := range c.Args {
+		if arg.Variadic {
+			if len(args) <= i && arg.Required {
+				return nil, fmt.Errorf("missing argument %s", arg.Name)
+			}
+			for _, value := range args[min(i, len(args)):] {
+				if err := checkArgType(arg, value); err != nil {
+					return nil, err
+				}
+				validated = append(validated, value)
+			}
+			return validated, nil
+		}
+
+		if i >= len(args) {
+			if arg.Required {
+				return nil, fmt.Errorf("missing argument %s", arg.Name)
+			}
+			if arg.Default == "" {
+				// nothing to fill in, the following args are optional too
+				return validated, nil
+			}
+			validated = append(validated, arg.Default)
+			continue
+		}
+		if err := checkArgType(arg, args[i]); err != nil {
+			return nil, err
+		}
+		validated = append(validated, args[i])
+	}
+
+	if len(args) > len(c.Args) {
+		return nil, fmt.Errorf("too many arguments, expected at most %d", len(c.Args))
+	}
+	return validated, nil
+}
+
+// Usage renders the argument list like "<name> [count] [args...]"
+func (c Command) Usage() string {
+	parts := make([]string, 0, len(c.Args))
+	for _, arg := range c.Args {
+		name := arg.Name
+		if arg.Variadic {
+			name += "..."
+		}
+		if arg.Required {
+			parts = append(parts, "<"+name+">")
+		} else {
+			parts = append(parts, "["+name+"]")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// CommandInfo is a command together with its name and the plugin providing it
+type CommandInfo struct {
+	Plugin string `json:"plugin"`
+	Name   string `json:"command"`
+	Command
+}
+
+// RenderCommandNames is the JSON list of the command names only
+func RenderCommandNames(commands []CommandInfo) string {
+	names := make([]string, 0, len(commands))
+	for _, info := range commands {
+		names = append(names, info.Name)
+	}
+	bytes, err := json.Marshal(names)
+	if err != nil {
+		return "Error encoding supported commands"
+	}
+	return string(bytes)
+}
+
+func RenderHelpJSON(commands []CommandInfo) string {
+	bytes, err := json.Marshal(commands)
+	if err != nil {
+		return "Error encoding supported commands"
+	}
+	return string(bytes)
+}
+
+func RenderHelpText(commands []CommandInfo) string {
+	var out strings.Builder
+	lastPlugin := ""
+	for _, info := range commands {
+		if info.Plugin != lastPlugin {
+			fmt.Fprintf(&out, "%s:\n", info.Plugin)
+			lastPlugin = info.Plugin
+		}
+		fmt.Fprintf(&out, "  %s %s\n", info.Name, info.Usage())
+		fmt.Fprintf(&out, "      %s\n", info.Description)
+		for _, arg := range info.Args {
+			qualifier := "optional"
+			if arg.Required {
+				qualifier = "required"
+			}
+			if arg.Default != "" {
+				qualifier += ", default " + arg.Default
+			}
+			fmt.Fprintf(&out, "      %-12s %-8s (%s) %s\n", arg.Name, arg.Type, qualifier, arg.Description)
+		}
+	}
+	return strings.TrimRight(out.String(), "\n")
+}
@@ -0,0 +1,92 @@
+package plugin
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	journal := Command{Args: []Arg{
+		{Name: "unit", Type: ArgString, Required: true},
+		{Name: "window", Type: ArgDuration, Default: "1h"},
+		{Name: "lines", Type: ArgInt},
+	}}
+	run := Command{Args: []Arg{
+		{Name: "script", Type: ArgString, Required: true},
+		{Name: "args", Type: ArgInt, Variadic: true},
+	}}
+	dump := Command{Args: []Arg{DumpDirArg}}
+
+	tests := []struct {
+		name    string
+		command Command
+		args    []string
+		want    []string
+		wantErr bool
+	}{
+		{"all given", journal, []string{"eos.service", "10m", "5"}, []string{"eos.service", "10m", "5"}, false},
+		{"default filled in", journal, []string{"eos.service"}, []string{"eos.service", "1h"}, false},
+		{"optional without default", journal, []string{"eos.service", "2h"}, []string{"eos.service", "2h"}, false},
+		{"missing required", journal, nil, nil, true},
+		{"invalid duration", journal, []string{"eos.service", "soon"}, nil, true},
+		{"invalid int", journal, []string{"eos.service", "1h", "many"}, nil, true},
+		{"too many", journal, []string{"eos.service", "1h", "5", "extra"}, nil, true},
+		{"variadic", run, []string{"x.sh", "1", "2", "3"}, []string{"x.sh", "1", "2", "3"}, false},
+		{"variadic empty", run, []string{"x.sh"}, []string{"x.sh"}, false},
+		{"variadic checked", run, []string{"x.sh", "1", "two"}, nil, true},
+		{"path", dump, []string{"/var/log/argeos"}, []string{"/var/log/argeos"}, false},
+		{"empty path", dump, []string{""}, nil, true},
+		{"no args", Command{}, nil, []string{}, false},
+		{"no args expected", Command{}, []string{"x"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.command.Validate(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUsage(t *testing.T) {
+	command := Command{Args: []Arg{
+		{Name: "script", Required: true},
+		{Name: "count"},
+		{Name: "args", Variadic: true},
+	}}
+	if got := command.Usage(); got != "<script> [count] [args...]" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestCommandUnmarshal(t *testing.T) {
+	var commands map[string]Command
+	data := `{"plain": "Just a description",
+		"schema": {"description": "With args", "args": [{"name": "n", "type": "int", "required": true}]}}`
+	if err := json.Unmarshal([]byte(data), &commands); err != nil {
+		t.Fatal(err)
+	}
+	if commands["plain"].Description != "Just a description" || len(commands["plain"].Args) != 0 {
+		t.Errorf("plain description: got %+v", commands["plain"])
+	}
+	want := Command{Description: "With args", Args: []Arg{{Name: "n", Type: ArgInt, Required: true}}}
+	if !reflect.DeepEqual(commands["schema"], want) {
+		t.Errorf("schema: got %+v, want %+v", commands["schema"], want)
+	}
+}
+
+func TestRenderCommandNames(t *testing.T) {
+	commands := []CommandInfo{
+		{Plugin: "process", Name: "diagnostic_dump"},
+		{Plugin: "systemd", Name: "diagnostic_dump"},
+		{Plugin: "systemd", Name: "journal", Command: Command{Args: []Arg{{Name: "unit"}}}},
+	}
+	if got := RenderCommandNames(commands); got != `["diagnostic_dump","diagnostic_dump","journal"]` {
+		t.Errorf("got %s", got)
+	}
+}
@@ -0,0 +1,21 @@
+package plugin
+
+import (
+	"encoding/json"
+
+	"gitlab.cern.ch/eos/argeos/config"
+)
+
+// DecodeConfig decodes the config section of the named plugin into out,
+// leaving out untouched when the section does not exist.
+func DecodeConfig(cfg config.Config, name string, out any) error {
+	pluginConfig, exists := cfg.Plugins[name]
+	if !exists {
+		return nil
+	}
+	cfgBytes, err := json.Marshal(pluginConfig)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(cfgBytes, out)
+}
@@ -0,0 +1,264 @@
+package external
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.cern.ch/eos/argeos/config"
+	"gitlab.cern.ch/eos/argeos/internal/common"
+	"gitlab.cern.ch/eos/argeos/internal/logger"
+	"gitlab.cern.ch/eos/argeos/pkg/plugin"
+)
+
+type PluginConfig struct {
+	Command         string            `json:"command"`
+	Args            []string          `json:"args"`
+	EnvVars         map[string]string `json:"env_vars"`
+	CallTimeout     int32             `json:"call_timeout"`      // seconds
+	MaxCallTimeouts int               `json:"max_call_timeouts"` // timeouts in a row before a restart
+}
+
+const (
+	DefaultCallTimeout     = 60
+	DefaultMaxCallTimeouts = 3
+	shutdownGrace          = 5 * time.Second
+)
+
+var errNotRunning = errors.New("plugin process is not running")
+
+// ExternalPlugin proxies the Plugin interface to a separate executable that
+// speaks JSON-RPC over its stdin/stdout, see README.md for the protocol.
+type ExternalPlugin struct {
+	name   string
+	config PluginConfig
+
+	mu          sync.RWMutex // guards client and commandHelp
+	client      *client
+	commandHelp map[string]plugin.Command
+
+	healthUpdates chan common.HealthStatus
+}
+
+type executeParams struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+}
+
+type healthResult struct {
+	State     string `json:"state"`
+	Component string `json:"component,omitempty"`
+	Detail    string `json:"detail"`
+}
+
+func extractConfig(cfg config.Config) map[string]PluginConfig {
+	pluginConfig, exists := cfg.Plugins["external"]
+	if !exists {
+		return nil
+	}
+	cfgBytes, err := json.Marshal(pluginConfig)
+	if err != nil {
+		logger.Logger.Error("Error marshalling plugin config", "error", err)
+		return nil
+	}
+	var configs map[string]PluginConfig
+	err = json.Unmarshal(cfgBytes, &configs)
+	if err != nil {
+		logger.Logger.Error("Error unmarshalling plugin config", "error", err)
+		return nil
+	}
+	return configs
+}
+
+// NewPlugins returns one plugin per entry of the "external" plugin config,
+// keyed by plugin name. The processes are only started by PluginManager.Start.
+func NewPlugins(cfg config.Config) []plugin.Plugin {
+	configs := extractConfig(cfg)
+	names := make([]string, 0, len(configs))
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	plugins := make([]plugin.Plugin, 0, len(names))
+	for _, name := range names {
+		pluginConfig := configs[name]
+		if pluginConfig.Command == "" {
+			logger.Logger.Error("External plugin has no command configured, skipping", "plugin", name)
+			continue
+		}
+		if pluginConfig.CallTimeout <= 0 {
+			pluginConfig.CallTimeout = DefaultCallTimeout
+		}
+		if pluginConfig.MaxCallTimeouts <= 0 {
+			pluginConfig.MaxCallTimeouts = DefaultMaxCallTimeouts
+		}
+		plugins = append(plugins, &ExternalPlugin{
+			name:          name,
+			config:        pluginConfig,
+			commandHelp:   map[string]plugin.Command{},
+			healthUpdates: make(chan common.HealthStatus, 16),
+		})
+	}
+	return plugins
+}
+
+func (ep *ExternalPlugin) Name() string {
+	return ep.name
+}
+
+func (ep *ExternalPlugin) callTimeout() time.Duration {
+	return time.Duration(ep.config.CallTimeout) * time.Second
+}
+
+func (ep *ExternalPlugin) running() *client {
+	ep.mu.RLock()
+	defer ep.mu.RUnlock()
+	if ep.client == nil || ep.client.exited() {
+		return nil
+	}
+	return ep.client
+}
+
+func (ep *ExternalPlugin) Launch() error {
+	cmd := exec.Command(ep.config.Command, ep.config.Args...)
+	cmd.Env = os.Environ()
+	for k, v := range ep.config.EnvVars {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+	}
+
+	c, err := startClient(ep.name, cmd, ep.config.MaxCallTimeouts, ep.handleNotification)
+	if err != nil {
+		return err
+	}
+
+	var name string
+	if err := c.call("name", nil, &name, ep.callTimeout()); err != nil {
+		c.close(shutdownGrace)
+		return fmt.Errorf("handshake failed: %w", err)
+	}
+	if name != ep.name {
+		logger.Logger.Warn("External plugin reports a different name than configured", "plugin", ep.name, "reported", name)
+	}
+
+	var commandHelp map[string]plugin.Command
+	if err := c.call("command_help", nil, &commandHelp, ep.callTimeout()); err != nil {
+		c.close(shutdownGrace)
+		return fmt.Errorf("handshake failed: %w", err)
+	}
+
+	ep.mu.Lock()
+	ep.client = c
+	ep.commandHelp = commandHelp
+	ep.mu.Unlock()
+	return nil
+}
+
+func (ep *ExternalPlugin) Wait() error {
+	ep.mu.RLock()
+	c := ep.client
+	ep.mu.RUnlock()
+	if c == nil {
+		return errNotRunning
+	}
+	return c.wait()
+}
+
+func (ep *ExternalPlugin) Shutdown() {
+	if c := ep.running(); c != nil {
+		c.close(shutdownGrace)
+	}
+}
+
+func (ep *ExternalPlugin) CommandHelp() map[string]plugin.Command {
+	ep.mu.RLock()
+	defer ep.mu.RUnlock()
+	commandHelp := make(map[string]plugin.Command, len(ep.commandHelp))
+	for command, help := range ep.commandHelp {
+		commandHelp[command] = help
+	}
+	return commandHelp
+}
+
+func (ep *ExternalPlugin) Execute(command string, args ...string) (string, error) {
+	c := ep.running()
+	if c == nil {
+		return "", errNotRunning
+	}
+	if args == nil {
+		args = []string{}
+	}
+	var output string
+	err := c.call("execute", executeParams{Command: command, Args: args}, &output, ep.callTimeout())
+	return output, err
+}
+
+func (ep *ExternalPlugin) toHealthStatus(result healthResult) common.HealthStatus {
+	state, ok := common.HealthStateFromString(result.State)
+	if !ok {
+		return common.HealthERROR(fmt.Sprintf("invalid health state %q: %s", result.State, result.Detail)).WithComponent(ep.name)
+	}
+	component := ep.name
+	if result.Component != "" {
+		component = fmt.Sprintf("%s/%s", ep.name, result.Component)
+	}
+	return common.HealthStatus{
+		State:       state,
+		StateString: common.HealthStateString(state),
+		Name:        component,
+		Detail:      result.Detail,
+	}
+}
+
+func (ep *ExternalPlugin) HealthCheck() common.HealthStatus {
+	c := ep.running()
+	if c == nil {
+		return common.HealthERROR(errNotRunning.Error())
+	}
+	var result healthResult
+	if err := c.call("health_check", nil, &result, ep.callTimeout()); err != nil {
+		return common.HealthERROR(err.Error())
+	}
+	return ep.toHealthStatus(result)
+}
+
+// handleNotification receives the optional health stream: plugins may send
+// "health" notifications at any time, which are forwarded to the
+// DiagnosticMonitor while it is running.
+func (ep *ExternalPlugin) handleNotification(method string, params json.RawMessage) {
+	if method != "health" {
+		logger.Logger.Debug("Ignoring notification from external plugin", "plugin", ep.name, "method", method)
+		return
+	}
+	var result healthResult
+	if err := json.Unmarshal(params, &result); err != nil {
+		logger.Logger.Warn("Invalid health notification from external plugin", "plugin", ep.name, "error", err)
+		return
+	}
+	select {
+	case ep.healthUpdates <- ep.toHealthStatus(result):
+	default:
+		logger.Logger.Warn("Dropping health update from external plugin, queue full", "plugin", ep.name)
+	}
+}
+
+func (ep *ExternalPlugin) Start(ctx context.Context, updateChannel chan<- common.HealthStatus) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case update := <-ep.healthUpdates:
+			updateChannel <- update
+		}
+	}
+}
+
+func (ep *ExternalPlugin) Stop() {
+	logger.Logger.Info("Stopping external plugin health stream", "plugin", ep.name)
+}
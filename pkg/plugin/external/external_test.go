@@ -0,0 +1,218 @@
+package external
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.cern.ch/eos/argeos/config"
+	"gitlab.cern.ch/eos/argeos/internal/common"
+	"gitlab.cern.ch/eos/argeos/internal/logger"
+	"gitlab.cern.ch/eos/argeos/pkg/plugin"
+)
+
+func TestMain(m *testing.M) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	os.Exit(m.Run())
+}
+
+// fakePlugin answers the requests of argeos by matching the JSON lines, the
+// command of execute selecting what it does
+const fakePlugin = `#!/bin/sh
+while IFS= read -r line; do
+	id=$(echo "$line" | sed -n 's/.*"id":\([0-9]*\).*/\1/p')
+	reply() { echo "{\"jsonrpc\":\"2.0\",\"id\":$id,\"result\":$1}"; }
+	case "$line" in
+	*'"method":"name"'*)
+		reply '"fake"' ;;
+	*'"method":"command_help"'*)
+		reply '{"hello":"Say hello","hang":"Never answer","notify":"Push a health update","crash":"Exit","spawn":"Leave a child holding stdout"}' ;;
+	*'"method":"health_check"'*)
+		reply '{"state":"WARN","detail":"degraded"}' ;;
+	*'"command":"hello"'*)
+		reply '"hello"' ;;
+	*'"command":"fail"'*)
+		echo "{\"jsonrpc\":\"2.0\",\"id\":$id,\"error\":{\"code\":1,\"message\":\"failed\"}}" ;;
+	*'"command":"hang"'*)
+		;;
+	*'"command":"notify"'*)
+		echo '{"jsonrpc":"2.0","method":"health","params":{"state":"FAIL","component":"fsck","detail":"stuck"}}'
+		reply '"notified"' ;;
+	*'"command":"crash"'*)
+		exit 1 ;;
+	*'"command":"spawn"'*)
+		setsid sleep 5 &
+		reply '"spawned"' ;;
+	esac
+done
+`
+
+func newTestPlugin(t *testing.T, command string, extra string) *ExternalPlugin {
+	t.Helper()
+	if command == "" {
+		command = filepath.Join(t.TempDir(), "fake")
+		if err := os.WriteFile(command, []byte(fakePlugin), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := config.Configure([]byte(`{"plugins": {"external": {"fake": {"command": "` + command + `"` + extra + `}}}}`))
+	plugins := NewPlugins(cfg)
+	if len(plugins) != 1 {
+		t.Fatalf("got %d plugins, want 1", len(plugins))
+	}
+	return plugins[0].(*ExternalPlugin)
+}
+
+func launch(t *testing.T, ep *ExternalPlugin) {
+	t.Helper()
+	if err := ep.Launch(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(ep.Shutdown)
+}
+
+func TestHandshakeAndExecute(t *testing.T) {
+	ep := newTestPlugin(t, "", "")
+	launch(t, ep)
+
+	commands := make([]string, 0)
+	for command := range ep.CommandHelp() {
+		commands = append(commands, command)
+	}
+	want := []string{"crash", "hang", "hello", "notify", "spawn"}
+	sort.Strings(commands)
+	if !reflect.DeepEqual(commands, want) {
+		t.Errorf("got commands %v, want %v", commands, want)
+	}
+	if out, err := ep.Execute("hello"); err != nil || out != "hello" {
+		t.Errorf("hello: got %q, %v", out, err)
+	}
+	var rpcErr *rpcError
+	if _, err := ep.Execute("fail"); !errors.As(err, &rpcErr) || rpcErr.Message != "failed" {
+		t.Errorf("fail: got %v, want the rpc error", err)
+	}
+	if status := ep.HealthCheck(); status.State != common.StateWARN || status.Detail != "degraded" {
+		t.Errorf("got health %+v, want WARN degraded", status)
+	}
+
+	ep.Shutdown()
+	if err := ep.Wait(); err != nil {
+		t.Errorf("got %v once stdin is closed, want a clean exit", err)
+	}
+	if _, err := ep.Execute("hello"); err != errNotRunning {
+		t.Errorf("got %v after shutdown, want errNotRunning", err)
+	}
+}
+
+func TestHandshakeFailure(t *testing.T) {
+	ep := newTestPlugin(t, "/bin/false", "")
+	if err := ep.Launch(); err == nil || !strings.Contains(err.Error(), "handshake failed") {
+		t.Errorf("got %v, want a failed handshake", err)
+	}
+}
+
+func TestCallTimeout(t *testing.T) {
+	ep := newTestPlugin(t, "", `, "call_timeout": 1, "max_call_timeouts": 2`)
+	launch(t, ep)
+
+	if _, err := ep.Execute("hang"); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("got %v, want a timeout", err)
+	}
+	// an answer in between resets the count
+	if _, err := ep.Execute("hello"); err != nil {
+		t.Fatal(err)
+	}
+	ep.Execute("hang")
+	if ep.running() == nil {
+		t.Fatal("killed after a single timeout in a row")
+	}
+	ep.Execute("hang")
+
+	exited := make(chan error, 1)
+	go func() { exited <- ep.Wait() }()
+	select {
+	case err := <-exited:
+		if err == nil || !strings.Contains(err.Error(), "unresponsive after 2 call timeouts") {
+			t.Errorf("got %v, want unresponsive", err)
+		}
+	case <-time.After(2 * shutdownGrace):
+		t.Error("unresponsive plugin not killed")
+	}
+}
+
+func TestHealthNotification(t *testing.T) {
+	ep := newTestPlugin(t, "", "")
+	launch(t, ep)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := make(chan common.HealthStatus, 1)
+	go ep.Start(ctx, updates)
+
+	if _, err := ep.Execute("notify"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case status := <-updates:
+		if status.State != common.StateFAIL || status.Name != "fake/fsck" || status.Detail != "stuck" {
+			t.Errorf("got %+v, want FAIL of fake/fsck", status)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("no health update")
+	}
+}
+
+func TestCloseWithChildHoldingOutput(t *testing.T) {
+	ep := newTestPlugin(t, "", "")
+	launch(t, ep)
+	if _, err := ep.Execute("spawn"); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	ep.running().close(100 * time.Millisecond)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("close took %s", elapsed)
+	}
+}
+
+func TestRestartAfterCrash(t *testing.T) {
+	ep := newTestPlugin(t, "", "")
+	pm := plugin.NewManager(config.ServerConfig{})
+	pm.Register(ep)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pm.Start(ctx)
+
+	waitRunning := func() time.Time {
+		t.Helper()
+		deadline := time.Now().Add(10 * time.Second)
+		for time.Now().Before(deadline) {
+			if out, err := ep.Execute("hello"); err == nil && out == "hello" {
+				return time.Now()
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		t.Fatal("plugin not running")
+		return time.Time{}
+	}
+
+	// each restart waits twice as long as the previous one
+	waitRunning()
+	for _, delay := range []time.Duration{time.Second, 2 * time.Second} {
+		crashed := time.Now()
+		if _, err := ep.Execute("crash"); err != errProcessExited {
+			t.Fatalf("got %v, want errProcessExited", err)
+		}
+		if restarted := waitRunning().Sub(crashed); restarted < delay {
+			t.Errorf("restarted after %s, want at least %s", restarted, delay)
+		}
+	}
+}
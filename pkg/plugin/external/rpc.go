@@ -0,0 +1,278 @@
+package external
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"gitlab.cern.ch/eos/argeos/internal/logger"
+)
+
+// Messages are JSON-RPC 2.0 objects, one per line, requests going to the
+// plugin's stdin and responses/notifications coming back on its stdout.
+type rpcRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      uint64 `json:"id"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *uint64         `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+var errProcessExited = errors.New("plugin process exited")
+
+type client struct {
+	name   string
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.Closer
+	stderr io.Closer
+	notify func(method string, params json.RawMessage)
+
+	// the plugin is killed after maxTimeouts calls in a row timed out
+	maxTimeouts int
+
+	writeMu      sync.Mutex
+	mu           sync.Mutex // guards nextID, pending, closed, timeouts and unresponsive
+	nextID       uint64
+	pending      map[uint64]chan rpcMessage
+	closed       bool
+	timeouts     int
+	unresponsive error
+
+	stderrDone chan struct{}
+	done       chan struct{} // closed once the process has been reaped
+	waitErr    error
+}
+
+// startClient starts the plugin in its own process group, so that close can
+// kill whatever it started as well
+func startClient(name string, cmd *exec.Cmd, maxTimeouts int, notify func(string, json.RawMessage)) (*client, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	c := &client{
+		name:        name,
+		cmd:         cmd,
+		stdin:       stdin,
+		stdout:      stdout,
+		stderr:      stderr,
+		notify:      notify,
+		maxTimeouts: maxTimeouts,
+		pending:     make(map[uint64]chan rpcMessage),
+		stderrDone:  make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go c.logStderr(stderr)
+	go c.readLoop(stdout)
+	return c, nil
+}
+
+func (c *client) logStderr(stderr io.Reader) {
+	defer close(c.stderrDone)
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		logger.Logger.Info("External plugin stderr", "plugin", c.name, "line", scanner.Text())
+	}
+}
+
+func (c *client) readLoop(stdout io.Reader) {
+	reader := bufio.NewReader(stdout)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			c.dispatch(line)
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	<-c.stderrDone
+	c.waitErr = c.cmd.Wait()
+	c.mu.Lock()
+	c.closed = true
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+	c.mu.Unlock()
+	close(c.done)
+}
+
+func (c *client) dispatch(line []byte) {
+	var msg rpcMessage
+	if err := json.Unmarshal(line, &msg); err != nil {
+		logger.Logger.Warn("Ignoring malformed message from external plugin", "plugin", c.name, "error", err)
+		return
+	}
+
+	if msg.ID == nil {
+		if msg.Method != "" && c.notify != nil {
+			c.notify(msg.Method, msg.Params)
+		}
+		return
+	}
+
+	c.mu.Lock()
+	ch, ok := c.pending[*msg.ID]
+	delete(c.pending, *msg.ID)
+	c.mu.Unlock()
+	if !ok {
+		logger.Logger.Warn("Response for unknown request from external plugin", "plugin", c.name, "id", *msg.ID)
+		return
+	}
+	ch <- msg
+}
+
+// call sends a request and decodes the result into result, giving up after
+// timeout. A late response to a timed out request is dropped.
+func (c *client) call(method string, params any, result any, timeout time.Duration) error {
+	ch := make(chan rpcMessage, 1)
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return errProcessExited
+	}
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	req, err := json.Marshal(rpcRequest{JSONRPC: "2.0", ID: id, Method: method, Params: params})
+	if err != nil {
+		c.forget(id)
+		return err
+	}
+	c.writeMu.Lock()
+	_, err = c.stdin.Write(append(req, '\n'))
+	c.writeMu.Unlock()
+	if err != nil {
+		c.forget(id)
+		return err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case msg, ok := <-ch:
+		if !ok {
+			return errProcessExited
+		}
+		c.mu.Lock()
+		c.timeouts = 0
+		c.mu.Unlock()
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(msg.Result, result)
+	case <-timer.C:
+		c.forget(id)
+		c.timedOut()
+		return fmt.Errorf("%s timed out after %s", method, timeout)
+	}
+}
+
+// timedOut counts a call that got no answer in time. A plugin that is still
+// running but stopped answering is killed, so that its supervisor restarts it.
+func (c *client) timedOut() {
+	c.mu.Lock()
+	c.timeouts++
+	kill := c.maxTimeouts > 0 && c.timeouts == c.maxTimeouts && c.unresponsive == nil
+	if kill {
+		c.unresponsive = fmt.Errorf("unresponsive after %d call timeouts in a row", c.timeouts)
+	}
+	c.mu.Unlock()
+	if kill {
+		logger.Logger.Error("External plugin stopped answering, killing it", "plugin", c.name, "timeouts", c.maxTimeouts)
+		go c.close(shutdownGrace)
+	}
+}
+
+func (c *client) forget(id uint64) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+func (c *client) wait() error {
+	<-c.done
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.unresponsive != nil {
+		return c.unresponsive
+	}
+	return c.waitErr
+}
+
+func (c *client) exited() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// close asks the plugin to exit by closing its stdin, and kills its process
+// group if it is still around after the grace period. A child that left the
+// group can keep the pipes open and the process unreaped: after another
+// grace period the pipes are closed, so that close always returns.
+func (c *client) close(grace time.Duration) {
+	c.stdin.Close()
+	select {
+	case <-c.done:
+		return
+	case <-time.After(grace):
+	}
+	logger.Logger.Warn("External plugin did not exit, killing it", "plugin", c.name)
+	syscall.Kill(-c.cmd.Process.Pid, syscall.SIGKILL)
+	select {
+	case <-c.done:
+		return
+	case <-time.After(grace):
+	}
+	logger.Logger.Warn("Output of killed external plugin still open, closing it", "plugin", c.name)
+	c.stdout.Close()
+	c.stderr.Close()
+	<-c.done
+}
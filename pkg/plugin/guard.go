@@ -0,0 +1,139 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"gitlab.cern.ch/eos/argeos/internal/common"
+	"gitlab.cern.ch/eos/argeos/internal/logger"
+)
+
+// PanicError is returned by SafeCall when the plugin panicked
+type PanicError struct {
+	Plugin string
+	Op     string
+	Value  any
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("plugin %s panicked in %s: %v", e.Plugin, e.Op, e.Value)
+}
+
+type QuarantineError struct {
+	Plugin string
+	Panics int
+}
+
+func (e *QuarantineError) Error() string {
+	return fmt.Sprintf("plugin %s is quarantined after %d panics", e.Plugin, e.Panics)
+}
+
+type panicRecord struct {
+	time   time.Time
+	plugin string
+	op     string
+	value  any
+	stack  []byte
+}
+
+// SafeCall runs fn, which is expected to call into the named plugin, and
+// converts a panic into a PanicError. Plugins that panicked panicQuarantine
+// times are not called anymore until they are released again. Only the
+// calling goroutine is protected: goroutines started by the plugin itself
+// have to recover on their own.
+func (pm *PluginManager) SafeCall(name string, op string, fn func()) (err error) {
+	if qerr := pm.quarantined(name); qerr != nil {
+		return qerr
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = pm.recordPanic(name, op, r, debug.Stack())
+		}
+	}()
+	fn()
+	return nil
+}
+
+// PluginName returns the name of the plugin, recording a panic of Name under
+// the plugin type instead.
+func (pm *PluginManager) PluginName(p interface{ Name() string }) (name string) {
+	defer func() {
+		if r := recover(); r != nil {
+			name = fmt.Sprintf("%T", p)
+			pm.recordPanic(name, "name", r, debug.Stack())
+		}
+	}()
+	return p.Name()
+}
+
+// SafeHealthCheck runs a health check through SafeCall, reporting panics and
+// quarantine as an ERROR status.
+func (pm *PluginManager) SafeHealthCheck(name string, check func() common.HealthStatus) common.HealthStatus {
+	var status common.HealthStatus
+	err := pm.SafeCall(name, "healthcheck", func() {
+		status = check()
+	})
+	if err != nil {
+		return common.HealthERROR(err.Error()).WithComponent(name)
+	}
+	return status
+}
+
+func (pm *PluginManager) quarantined(name string) error {
+	pm.panicMu.Lock()
+	defer pm.panicMu.Unlock()
+	if count := pm.panicCount[name]; count >= pm.panicQuarantine {
+		return &QuarantineError{Plugin: name, Panics: count}
+	}
+	return nil
+}
+
+func (pm *PluginManager) recordPanic(name string, op string, value any, stack []byte) error {
+	logger.Logger.Error("Plugin panicked", "plugin", name, "op", op, "panic", value, "stack", string(stack))
+
+	pm.panicMu.Lock()
+	defer pm.panicMu.Unlock()
+	pm.panicCount[name]++
+	if pm.panicCount[name] == pm.panicQuarantine {
+		logger.Logger.Error("Quarantining plugin after repeated panics", "plugin", name, "panics", pm.panicCount[name])
+	}
+	pm.panics = append(pm.panics, panicRecord{time: time.Now(), plugin: name, op: op, value: value, stack: stack})
+	return &PanicError{Plugin: name, Op: op, Value: value}
+}
+
+// Release lifts the quarantine of a plugin and resets its panic count
+func (pm *PluginManager) Release(name string) string {
+	pm.panicMu.Lock()
+	defer pm.panicMu.Unlock()
+	count, ok := pm.panicCount[name]
+	if !ok {
+		return fmt.Sprintf("Plugin %s has not panicked", name)
+	}
+	delete(pm.panicCount, name)
+	logger.Logger.Info("Releasing plugin from quarantine", "plugin", name, "panics", count)
+	return fmt.Sprintf("Plugin %s released after %d panics", name, count)
+}
+
+// dumpPanics writes the panics recorded since the previous dump to the dump
+// directory.
+func (pm *PluginManager) dumpPanics(dump_dir string) {
+	pm.panicMu.Lock()
+	panics := pm.panics
+	pm.panics = nil
+	pm.panicMu.Unlock()
+	if len(panics) == 0 {
+		return
+	}
+
+	var out strings.Builder
+	for _, p := range panics {
+		fmt.Fprintf(&out, "=== %s plugin=%s op=%s ===\npanic: %v\n%s\n", p.time.Format(time.RFC3339), p.plugin, p.op, p.value, p.stack)
+	}
+	if err := os.WriteFile(filepath.Join(dump_dir, "panics.txt"), []byte(out.String()), 0644); err != nil {
+		logger.Logger.Error("Error writing plugin panics to dump", "error", err)
+	}
+}
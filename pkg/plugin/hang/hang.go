@@ -0,0 +1,300 @@
+package hang
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.cern.ch/eos/argeos/config"
+	"gitlab.cern.ch/eos/argeos/internal/common"
+	"gitlab.cern.ch/eos/argeos/internal/logger"
+	"gitlab.cern.ch/eos/argeos/internal/procfs"
+	"gitlab.cern.ch/eos/argeos/pkg/plugin"
+)
+
+// PluginConfig thresholds are in seconds. Targets default to the ones of the
+// process plugin.
+type PluginConfig struct {
+	Targets        []procfs.Target `json:"targets"`
+	SampleInterval int32           `json:"sample_interval"`
+	WarnAfter      int32           `json:"warn_after"`
+	FailAfter      int32           `json:"fail_after"`
+	// Also flag processes whose threads made no progress at all (no cpu time,
+	// no context switch) for WarnAfter/FailAfter, not only D state threads
+	CheckProgress bool `json:"check_progress"`
+}
+
+const (
+	DefaultSampleInterval = 10
+	DefaultWarnAfter      = 60
+	DefaultFailAfter      = 300
+	maxReportedThreads    = 10
+)
+
+type threadKey struct {
+	pid int
+	tid int
+}
+
+type stuckThread struct {
+	since time.Time
+	comm  string
+	wchan string
+}
+
+type progress struct {
+	counter uint64
+	since   time.Time
+}
+
+type HangPlugin struct {
+	name        string
+	commandHelp map[string]plugin.Command
+	config      PluginConfig
+
+	mu       sync.Mutex // guards the sampling state below
+	dThreads map[threadKey]stuckThread
+	progress map[int]progress
+	targetOf map[int]string
+	last     *common.HealthStatus
+}
+
+func NewPlugin(cfg config.Config) plugin.Plugin {
+	var pluginConfig PluginConfig
+	if err := plugin.DecodeConfig(cfg, "hang", &pluginConfig); err != nil {
+		logger.Logger.Error("Error decoding hang plugin config", "error", err)
+	}
+	if len(pluginConfig.Targets) == 0 {
+		var processConfig struct {
+			Targets []procfs.Target `json:"targets"`
+		}
+		plugin.DecodeConfig(cfg, "process", &processConfig)
+		pluginConfig.Targets = processConfig.Targets
+	}
+	if pluginConfig.SampleInterval <= 0 {
+		pluginConfig.SampleInterval = DefaultSampleInterval
+	}
+	if pluginConfig.WarnAfter <= 0 {
+		pluginConfig.WarnAfter = DefaultWarnAfter
+	}
+	if pluginConfig.FailAfter <= 0 {
+		pluginConfig.FailAfter = DefaultFailAfter
+	}
+
+	return &HangPlugin{
+		name: "hang",
+		commandHelp: map[string]plugin.Command{
+			"hang_status": {Description: "Show threads of the target processes stuck in D state or without progress"},
+		},
+		config:   pluginConfig,
+		dThreads: make(map[threadKey]stuckThread),
+		progress: make(map[int]progress),
+		targetOf: make(map[int]string),
+	}
+}
+
+func (hp *HangPlugin) Name() string {
+	return hp.name
+}
+
+func (hp *HangPlugin) CommandHelp() map[string]plugin.Command {
+	return hp.commandHelp
+}
+
+// sample records the D state threads and progress counters of all targets,
+// forgetting about processes and threads that went away.
+func (hp *HangPlugin) sample(now time.Time) {
+	seenThreads := make(map[threadKey]bool)
+	seenPids := make(map[int]bool)
+
+	hp.mu.Lock()
+	defer hp.mu.Unlock()
+	for _, target := range hp.config.Targets {
+		pids, err := target.Resolve()
+		if err != nil {
+			logger.Logger.Debug("Error resolving target", "target", target.Name, "error", err)
+			continue
+		}
+		for _, pid := range pids {
+			tids, err := procfs.Threads(pid)
+			if err != nil {
+				continue
+			}
+			seenPids[pid] = true
+			hp.targetOf[pid] = target.Name
+
+			var counter uint64
+			for _, tid := range tids {
+				stat, err := procfs.ThreadStat(pid, tid)
+				if err != nil {
+					continue
+				}
+				if schedstat, err := procfs.Schedstat(pid, tid); err == nil {
+					counter += schedstat[0] + schedstat[2]
+				}
+				if stat.State != "D" {
+					continue
+				}
+				key := threadKey{pid, tid}
+				seenThreads[key] = true
+				thread, ok := hp.dThreads[key]
+				if !ok {
+					thread = stuckThread{since: now}
+				}
+				thread.comm = stat.Comm
+				thread.wchan = procfs.Wchan(pid, tid)
+				hp.dThreads[key] = thread
+			}
+
+			if p, ok := hp.progress[pid]; !ok || p.counter != counter {
+				hp.progress[pid] = progress{counter: counter, since: now}
+			}
+		}
+	}
+
+	for key := range hp.dThreads {
+		if !seenThreads[key] {
+			delete(hp.dThreads, key)
+		}
+	}
+	for pid := range hp.progress {
+		if !seenPids[pid] {
+			delete(hp.progress, pid)
+			delete(hp.targetOf, pid)
+		}
+	}
+}
+
+// report lists the stuck threads and processes at least minAge old, oldest
+// first, and returns the longest stuck duration.
+func (hp *HangPlugin) report(now time.Time, minAge time.Duration) ([]string, time.Duration) {
+	hp.mu.Lock()
+	defer hp.mu.Unlock()
+
+	type entry struct {
+		age  time.Duration
+		line string
+	}
+	entries := make([]entry, 0)
+	for key, thread := range hp.dThreads {
+		age := now.Sub(thread.since)
+		if age < minAge {
+			continue
+		}
+		entries = append(entries, entry{age, fmt.Sprintf("%s pid %d tid %d (%s) in D state for %s, wchan=%s",
+			hp.targetOf[key.pid], key.pid, key.tid, thread.comm, age.Round(time.Second), thread.wchan)})
+	}
+	if hp.config.CheckProgress {
+		for pid, p := range hp.progress {
+			age := now.Sub(p.since)
+			if age < minAge {
+				continue
+			}
+			entries = append(entries, entry{age, fmt.Sprintf("%s pid %d made no progress for %s",
+				hp.targetOf[pid], pid, age.Round(time.Second))})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].age > entries[j].age })
+	lines := make([]string, 0, len(entries))
+	for _, e := range entries {
+		lines = append(lines, e.line)
+	}
+	if len(entries) == 0 {
+		return lines, 0
+	}
+	return lines, entries[0].age
+}
+
+func (hp *HangPlugin) evaluate(now time.Time) common.HealthStatus {
+	warnAfter := time.Duration(hp.config.WarnAfter) * time.Second
+	failAfter := time.Duration(hp.config.FailAfter) * time.Second
+
+	lines, longest := hp.report(now, warnAfter)
+	if len(lines) == 0 {
+		return common.HealthOK("No stuck threads").WithComponent(hp.name)
+	}
+	if len(lines) > maxReportedThreads {
+		lines = append(lines[:maxReportedThreads], fmt.Sprintf("and %d more", len(lines)-maxReportedThreads))
+	}
+	detail := strings.Join(lines, "; ")
+	if longest >= failAfter {
+		return common.HealthFAIL(detail).WithComponent(hp.name)
+	}
+	return common.HealthWARN(detail).WithComponent(hp.name)
+}
+
+func (hp *HangPlugin) check() common.HealthStatus {
+	now := time.Now()
+	hp.sample(now)
+	status := hp.evaluate(now)
+	hp.mu.Lock()
+	hp.last = &status
+	hp.mu.Unlock()
+	return status
+}
+
+func (hp *HangPlugin) Execute(command string, args ...string) (string, error) {
+	switch command {
+	case "hang_status":
+		// what this very sample saw first has not been stuck for any time yet,
+		// only report what has been for at least a sample interval
+		now := time.Now()
+		hp.sample(now)
+		lines, _ := hp.report(now, time.Duration(hp.config.SampleInterval)*time.Second)
+		if len(lines) == 0 {
+			return "No stuck threads", nil
+		}
+		return strings.Join(lines, "\n"), nil
+	default:
+		return "", fmt.Errorf("command not implemented")
+	}
+}
+
+// HealthCheck returns the state of the last sample, sampling now if the
+// daemon is not running.
+func (hp *HangPlugin) HealthCheck() common.HealthStatus {
+	hp.mu.Lock()
+	last := hp.last
+	hp.mu.Unlock()
+	if last != nil {
+		return *last
+	}
+	if len(hp.config.Targets) == 0 {
+		return common.HealthWARN("No target processes configured")
+	}
+	return hp.check()
+}
+
+func (hp *HangPlugin) Start(ctx context.Context, updateChannel chan<- common.HealthStatus) error {
+	if len(hp.config.Targets) == 0 {
+		logger.Logger.Warn("No target processes configured, not starting hang detector")
+		return nil
+	}
+
+	logger.Logger.Info("Starting hang detector", "targets", len(hp.config.Targets), "interval", hp.config.SampleInterval)
+	ticker := time.NewTicker(time.Duration(hp.config.SampleInterval) * time.Second)
+	defer ticker.Stop()
+	previous := common.StateOK
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Logger.Info("Hang detector stopped")
+			return nil
+		case <-ticker.C:
+			status := hp.check()
+			// only report changes and ongoing trouble, not every OK sample
+			if status.State != common.StateOK || previous != common.StateOK {
+				updateChannel <- status
+			}
+			previous = status.State
+		}
+	}
+}
+
+func (hp *HangPlugin) Stop() {
+	logger.Logger.Info("Stopping hang detector")
+}
@@ -0,0 +1,257 @@
+package hang
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.cern.ch/eos/argeos/internal/common"
+	"gitlab.cern.ch/eos/argeos/internal/logger"
+	"gitlab.cern.ch/eos/argeos/internal/procfs"
+)
+
+func TestMain(m *testing.M) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	os.Exit(m.Run())
+}
+
+const testPid = 100
+
+type fakeThread struct {
+	state   string
+	cputime uint64
+}
+
+// fakeProc writes the threads of testPid into a procfs tree at procfs.Root
+func fakeProc(t *testing.T, threads map[int]fakeThread) {
+	t.Helper()
+	os.RemoveAll(procfs.PidPath(testPid))
+	for tid, thread := range threads {
+		dir := procfs.TaskPath(testPid, tid)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		files := map[string]string{
+			"stat":      fmt.Sprintf("%d (xrootd) %s 1 1 1 0 -1 0 0 0 0 0 0 0 0 0 20 0 2 0 100 0\n", tid, thread.state),
+			"schedstat": fmt.Sprintf("%d 0 5\n", thread.cputime),
+			"wchan":     "fuse_request_send",
+		}
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func newTestPlugin(t *testing.T, checkProgress bool) *HangPlugin {
+	t.Helper()
+	previous := procfs.Root
+	t.Cleanup(func() { procfs.Root = previous })
+	procfs.Root = t.TempDir()
+	pidfile := filepath.Join(t.TempDir(), "xrootd.pid")
+	if err := os.WriteFile(pidfile, []byte(fmt.Sprint(testPid)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return &HangPlugin{
+		name: "hang",
+		config: PluginConfig{
+			Targets:        []procfs.Target{{Name: "fst", Pidfile: pidfile}},
+			SampleInterval: 10, WarnAfter: 60, FailAfter: 300, CheckProgress: checkProgress,
+		},
+		dThreads: make(map[threadKey]stuckThread),
+		progress: make(map[int]progress),
+		targetOf: make(map[int]string),
+	}
+}
+
+func TestSample(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	type step struct {
+		threads       map[int]fakeThread
+		wantD         map[int]time.Duration // tid to how long ago it entered D state
+		wantProgress  time.Duration         // how long ago the process last made progress
+		wantProcesses int
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "D state kept until it ends",
+			steps: []step{
+				{threads: map[int]fakeThread{100: {"S", 10}, 101: {"D", 10}}, wantD: map[int]time.Duration{101: 0}, wantProcesses: 1},
+				{threads: map[int]fakeThread{100: {"S", 20}, 101: {"D", 10}}, wantD: map[int]time.Duration{101: 10 * time.Second}, wantProcesses: 1},
+				{threads: map[int]fakeThread{100: {"S", 30}, 101: {"S", 10}}, wantD: map[int]time.Duration{}, wantProcesses: 1},
+			},
+		},
+		{
+			name: "progress",
+			steps: []step{
+				{threads: map[int]fakeThread{100: {"S", 10}}, wantD: map[int]time.Duration{}, wantProcesses: 1},
+				{threads: map[int]fakeThread{100: {"S", 10}}, wantD: map[int]time.Duration{}, wantProgress: 10 * time.Second, wantProcesses: 1},
+				{threads: map[int]fakeThread{100: {"S", 10}}, wantD: map[int]time.Duration{}, wantProgress: 20 * time.Second, wantProcesses: 1},
+				{threads: map[int]fakeThread{100: {"R", 11}}, wantD: map[int]time.Duration{}, wantProcesses: 1},
+			},
+		},
+		{
+			name: "process gone",
+			steps: []step{
+				{threads: map[int]fakeThread{100: {"D", 10}}, wantD: map[int]time.Duration{100: 0}, wantProcesses: 1},
+				{threads: nil, wantD: map[int]time.Duration{}, wantProcesses: 0},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hp := newTestPlugin(t, true)
+			for i, step := range tt.steps {
+				now := start.Add(time.Duration(i) * 10 * time.Second)
+				fakeProc(t, step.threads)
+				hp.sample(now)
+
+				gotD := make(map[int]time.Duration)
+				for key, thread := range hp.dThreads {
+					gotD[key.tid] = now.Sub(thread.since)
+				}
+				if !reflect.DeepEqual(gotD, step.wantD) {
+					t.Errorf("step %d: got D threads %v, want %v", i, gotD, step.wantD)
+				}
+				if len(hp.progress) != step.wantProcesses {
+					t.Fatalf("step %d: got %d processes, want %d", i, len(hp.progress), step.wantProcesses)
+				}
+				if p, ok := hp.progress[testPid]; ok && now.Sub(p.since) != step.wantProgress {
+					t.Errorf("step %d: no progress for %s, want %s", i, now.Sub(p.since), step.wantProgress)
+				}
+			}
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	hp := &HangPlugin{
+		dThreads: map[threadKey]stuckThread{
+			{testPid, 101}: {since: now.Add(-90 * time.Second), comm: "xrootd", wchan: "fuse_request_send"},
+			{testPid, 102}: {since: now.Add(-30 * time.Second), comm: "xrootd", wchan: "io_schedule"},
+		},
+		progress: map[int]progress{testPid: {counter: 1, since: now.Add(-120 * time.Second)}},
+		targetOf: map[int]string{testPid: "fst"},
+	}
+	tests := []struct {
+		name          string
+		checkProgress bool
+		minAge        time.Duration
+		want          []string
+		wantLongest   time.Duration
+	}{
+		{
+			name:   "oldest first",
+			minAge: 0,
+			want: []string{
+				"fst pid 100 tid 101 (xrootd) in D state for 1m30s, wchan=fuse_request_send",
+				"fst pid 100 tid 102 (xrootd) in D state for 30s, wchan=io_schedule",
+			},
+			wantLongest: 90 * time.Second,
+		},
+		{
+			name:   "younger than minAge left out",
+			minAge: time.Minute,
+			want: []string{
+				"fst pid 100 tid 101 (xrootd) in D state for 1m30s, wchan=fuse_request_send",
+			},
+			wantLongest: 90 * time.Second,
+		},
+		{
+			name:          "with progress",
+			checkProgress: true,
+			minAge:        time.Minute,
+			want: []string{
+				"fst pid 100 made no progress for 2m0s",
+				"fst pid 100 tid 101 (xrootd) in D state for 1m30s, wchan=fuse_request_send",
+			},
+			wantLongest: 120 * time.Second,
+		},
+		{name: "nothing old enough", minAge: time.Hour, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hp.config.CheckProgress = tt.checkProgress
+			got, longest := hp.report(now, tt.minAge)
+			if !reflect.DeepEqual(got, tt.want) || longest != tt.wantLongest {
+				t.Errorf("got %q, %s, want %q, %s", got, longest, tt.want, tt.wantLongest)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		stuck []time.Duration
+		want  common.HealthState
+	}{
+		{name: "none", want: common.StateOK},
+		{name: "below warn_after", stuck: []time.Duration{59 * time.Second}, want: common.StateOK},
+		{name: "warn", stuck: []time.Duration{time.Minute, 10 * time.Second}, want: common.StateWARN},
+		{name: "fail", stuck: []time.Duration{time.Minute, 5 * time.Minute}, want: common.StateFAIL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hp := &HangPlugin{
+				name:     "hang",
+				config:   PluginConfig{WarnAfter: 60, FailAfter: 300},
+				dThreads: make(map[threadKey]stuckThread),
+				targetOf: map[int]string{testPid: "fst"},
+			}
+			for i, age := range tt.stuck {
+				hp.dThreads[threadKey{testPid, testPid + i}] = stuckThread{since: now.Add(-age)}
+			}
+			if got := hp.evaluate(now); got.State != tt.want {
+				t.Errorf("got %s (%s), want %s", got.StateString, got.Detail, common.HealthStateString(tt.want))
+			}
+		})
+	}
+}
+
+func TestEvaluateCapsThreads(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	hp := &HangPlugin{
+		name:     "hang",
+		config:   PluginConfig{WarnAfter: 60, FailAfter: 300},
+		dThreads: make(map[threadKey]stuckThread),
+	}
+	for tid := 0; tid < maxReportedThreads+5; tid++ {
+		hp.dThreads[threadKey{testPid, tid}] = stuckThread{since: now.Add(-time.Minute)}
+	}
+	if got := hp.evaluate(now).Detail; !strings.HasSuffix(got, "; and 5 more") {
+		t.Errorf("got %q, want the threads past %d summed up", got, maxReportedThreads)
+	}
+}
+
+func TestHangStatusSkipsFreshEntries(t *testing.T) {
+	hp := newTestPlugin(t, true)
+	fakeProc(t, map[int]fakeThread{100: {"S", 10}, 101: {"D", 10}})
+
+	out, err := hp.Execute("hang_status")
+	if err != nil || out != "No stuck threads" {
+		t.Errorf("first sample: got %q, %v, want nothing stuck yet", out, err)
+	}
+
+	// as if the first sample had been taken an interval ago
+	for key, thread := range hp.dThreads {
+		thread.since = thread.since.Add(-10 * time.Second)
+		hp.dThreads[key] = thread
+	}
+	out, err = hp.Execute("hang_status")
+	if err != nil || out != "fst pid 100 tid 101 (xrootd) in D state for 10s, wchan=fuse_request_send" {
+		t.Errorf("got %q, %v, want only the D state thread", out, err)
+	}
+}
@@ -0,0 +1,326 @@
+package kernel
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.cern.ch/eos/argeos/config"
+	"gitlab.cern.ch/eos/argeos/internal/common"
+	"gitlab.cern.ch/eos/argeos/internal/kmsg"
+	"gitlab.cern.ch/eos/argeos/internal/logger"
+	"gitlab.cern.ch/eos/argeos/pkg/plugin"
+)
+
+// PatternConfig trips when Pattern matches more than Threshold kernel
+// messages within Window seconds, reporting State. Patterns named like one
+// of the defaults replace it, a State of OK disables it.
+type PatternConfig struct {
+	Name      string `json:"name"`
+	Pattern   string `json:"pattern"`
+	Threshold int    `json:"threshold"`
+	Window    int32  `json:"window"`
+	State     string `json:"state"`
+}
+
+type PluginConfig struct {
+	Patterns []PatternConfig `json:"patterns"`
+}
+
+const (
+	DefaultWindow = 600
+	// kernel messages kept for kernel_events
+	maxEvents = 100
+	// how often tripped patterns are re-evaluated so they expire
+	evaluateInterval = 10 * time.Second
+	// delays between attempts to follow kmsg after it failed
+	retryBackOff    = time.Second
+	maxRetryBackOff = 5 * time.Minute
+)
+
+var defaultPatterns = []PatternConfig{
+	{Name: "hung_task", Pattern: `blocked for more than \d+ seconds`, State: "FAIL"},
+	{Name: "soft_lockup", Pattern: `soft lockup|hard LOCKUP|rcu_\w+ (self-)?detected stall`, State: "FAIL"},
+	{Name: "io_error", Pattern: `I/O error|blk_update_request|critical medium error|Medium Error`, State: "WARN"},
+	{Name: "nic_reset", Pattern: `NETDEV WATCHDOG|transmit queue \d+ timed out|[Rr]eset adapter|Tx Unit Hang|tx hang`, State: "WARN"},
+}
+
+type pattern struct {
+	PatternConfig
+	re    *regexp.Regexp
+	state common.HealthState
+	hits  []time.Time
+}
+
+type KernelPlugin struct {
+	name        string
+	commandHelp map[string]plugin.Command
+
+	mu       sync.Mutex // guards patterns, events and readErr
+	patterns []*pattern
+	events   []kmsg.Record
+	readErr  error
+}
+
+func newPattern(cfg PatternConfig) (*pattern, error) {
+	re, err := regexp.Compile(cfg.Pattern)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultWindow
+	}
+	state := common.StateWARN
+	if cfg.State != "" {
+		var ok bool
+		if state, ok = common.HealthStateFromString(strings.ToUpper(cfg.State)); !ok {
+			return nil, fmt.Errorf("invalid state %q", cfg.State)
+		}
+	}
+	return &pattern{PatternConfig: cfg, re: re, state: state}, nil
+}
+
+// mergePatterns applies the configured patterns over the defaults
+func mergePatterns(configured []PatternConfig) []PatternConfig {
+	merged := append([]PatternConfig(nil), defaultPatterns...)
+	for _, cfg := range configured {
+		replaced := false
+		for i := range merged {
+			if merged[i].Name == cfg.Name {
+				merged[i] = cfg
+				replaced = true
+			}
+		}
+		if !replaced {
+			merged = append(merged, cfg)
+		}
+	}
+	return merged
+}
+
+func NewPlugin(cfg config.Config) plugin.Plugin {
+	var pluginConfig PluginConfig
+	if err := plugin.DecodeConfig(cfg, "kernel", &pluginConfig); err != nil {
+		logger.Logger.Error("Error decoding kernel plugin config", "error", err)
+	}
+
+	patterns := make([]*pattern, 0)
+	for _, patternConfig := range mergePatterns(pluginConfig.Patterns) {
+		p, err := newPattern(patternConfig)
+		if err != nil {
+			logger.Logger.Error("Invalid kernel log pattern, skipping", "pattern", patternConfig.Name, "error", err)
+			continue
+		}
+		if p.state == common.StateOK {
+			continue
+		}
+		patterns = append(patterns, p)
+	}
+
+	return &KernelPlugin{
+		name: "kernel",
+		commandHelp: map[string]plugin.Command{
+			"kernel_events":   {Description: "Show the recent kernel messages that matched a pattern"},
+			"dmesg":           {Description: "Show the kernel ring buffer"},
+			"diagnostic_dump": {Description: "Dump the kernel ring buffer and matched messages", Args: []plugin.Arg{plugin.DumpDirArg}},
+		},
+		patterns: patterns,
+	}
+}
+
+func (kp *KernelPlugin) Name() string {
+	return kp.name
+}
+
+func (kp *KernelPlugin) CommandHelp() map[string]plugin.Command {
+	return kp.commandHelp
+}
+
+// handle matches a kernel message, returning whether any pattern matched
+func (kp *KernelPlugin) handle(now time.Time, record kmsg.Record) bool {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+	matched := false
+	for _, p := range kp.patterns {
+		if p.re.MatchString(record.Message) {
+			p.hits = append(p.hits, now)
+			matched = true
+			logger.Logger.Warn("Kernel message matched", "pattern", p.Name, "message", record.Message)
+		}
+	}
+	if matched {
+		kp.events = append(kp.events, record)
+		if len(kp.events) > maxEvents {
+			kp.events = kp.events[len(kp.events)-maxEvents:]
+		}
+	}
+	return matched
+}
+
+func (kp *KernelPlugin) evaluate(now time.Time) common.HealthStatus {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+
+	worst := common.StateOK
+	problems := make([]string, 0)
+	for _, p := range kp.patterns {
+		cutoff := now.Add(-time.Duration(p.Window) * time.Second)
+		i := 0
+		for i < len(p.hits) && p.hits[i].Before(cutoff) {
+			i++
+		}
+		p.hits = p.hits[i:]
+		if len(p.hits) > p.Threshold {
+			worst = common.WorseState(worst, p.state)
+			problems = append(problems, fmt.Sprintf("%s: %d kernel messages in %ds", p.Name, len(p.hits), p.Window))
+		}
+	}
+	if kp.readErr != nil {
+		problems = append(problems, fmt.Sprintf("reading %s: %s", kmsg.Path, kp.readErr))
+		worst = common.WorseState(worst, common.StateERROR)
+	}
+	if len(problems) == 0 {
+		return common.HealthOK("No kernel trouble detected").WithComponent(kp.name)
+	}
+	return common.HealthStatus{
+		State:       worst,
+		StateString: common.HealthStateString(worst),
+		Name:        kp.name,
+		Detail:      strings.Join(problems, "; "),
+	}
+}
+
+func (kp *KernelPlugin) HealthCheck() common.HealthStatus {
+	return kp.evaluate(time.Now())
+}
+
+func (kp *KernelPlugin) setReadErr(err error) {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+	kp.readErr = err
+}
+
+func (kp *KernelPlugin) Start(ctx context.Context, updateChannel chan<- common.HealthStatus) error {
+	logger.Logger.Info("Starting kernel log watcher", "patterns", len(kp.patterns))
+	matched := make(chan struct{}, 1)
+	followErr := make(chan error, 1)
+	follow := func() {
+		go func() {
+			followErr <- kmsg.Follow(ctx, true, func(record kmsg.Record) {
+				if kp.handle(time.Now(), record) {
+					select {
+					case matched <- struct{}{}:
+					default:
+					}
+				}
+			})
+		}()
+	}
+	follow()
+	following := true
+	started := time.Now()
+
+	// retry is nil while following, kmsg may come back (permissions fixed,
+	// device made available to the container) without restarting argeos
+	var retry <-chan time.Time
+	delay := retryBackOff
+	ticker := time.NewTicker(evaluateInterval)
+	defer ticker.Stop()
+	previous := common.StateOK
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Logger.Info("Kernel log watcher stopped")
+			return nil
+		case err := <-followErr:
+			if err == nil {
+				return nil
+			}
+			following = false
+			kp.setReadErr(err)
+			// a follow that worked for a while starts over from the shortest
+			// delay
+			if time.Since(started) > time.Minute {
+				delay = retryBackOff
+			}
+			logger.Logger.Warn("Cannot follow the kernel log, retrying", "path", kmsg.Path, "error", err, "delay", delay)
+			retry = time.After(delay)
+			delay = min(delay*2, maxRetryBackOff)
+		case <-retry:
+			retry = nil
+			follow()
+			following = true
+			started = time.Now()
+		case <-matched:
+		case <-ticker.C:
+			// opening kmsg fails right away, a follow still running is
+			// reading it
+			if following && time.Since(started) >= time.Second {
+				kp.setReadErr(nil)
+			}
+		}
+		status := kp.evaluate(time.Now())
+		if status.State != previous {
+			updateChannel <- status
+		}
+		previous = status.State
+	}
+}
+
+func (kp *KernelPlugin) Stop() {
+	logger.Logger.Info("Stopping kernel log watcher")
+}
+
+func (kp *KernelPlugin) recentEvents() string {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+	return kmsg.Format(kp.events)
+}
+
+func dmesg() (string, error) {
+	records, err := kmsg.ReadAll()
+	if err != nil && len(records) == 0 {
+		return "", err
+	}
+	return kmsg.Format(records), nil
+}
+
+func (kp *KernelPlugin) diagnosticDump(dumpDir string) (string, error) {
+	kernelDir := filepath.Join(dumpDir, "kernel")
+	if err := os.MkdirAll(kernelDir, 0755); err != nil {
+		return "", err
+	}
+
+	out, err := dmesg()
+	if err != nil {
+		out = fmt.Sprintf("error: %s\n", err)
+	}
+	if err := os.WriteFile(filepath.Join(kernelDir, "dmesg.txt"), []byte(out), 0644); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(kernelDir, "events.txt"), []byte(kp.recentEvents()), 0644); err != nil {
+		return "", err
+	}
+	return "kernel: dumped ring buffer", nil
+}
+
+func (kp *KernelPlugin) Execute(command string, args ...string) (string, error) {
+	switch command {
+	case "kernel_events":
+		return kp.recentEvents(), nil
+	case "dmesg":
+		return dmesg()
+	case "diagnostic_dump":
+		if len(args) < 1 {
+			return "", fmt.Errorf("no diagnostic directory provided")
+		}
+		return kp.diagnosticDump(args[0])
+	default:
+		return "", fmt.Errorf("command not implemented")
+	}
+}
@@ -0,0 +1,155 @@
+package kernel
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.cern.ch/eos/argeos/internal/common"
+	"gitlab.cern.ch/eos/argeos/internal/kmsg"
+	"gitlab.cern.ch/eos/argeos/internal/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	os.Exit(m.Run())
+}
+
+func newTestPlugin(t *testing.T, configs []PatternConfig) *KernelPlugin {
+	t.Helper()
+	kp := &KernelPlugin{name: "kernel"}
+	for _, cfg := range configs {
+		p, err := newPattern(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kp.patterns = append(kp.patterns, p)
+	}
+	return kp
+}
+
+func TestDefaultPatterns(t *testing.T) {
+	tests := []struct {
+		message string
+		want    []string
+	}{
+		{"INFO: task xrootd:4242 blocked for more than 120 seconds.", []string{"hung_task"}},
+		{"watchdog: BUG: soft lockup - CPU#3 stuck for 22s! [xrootd:4242]", []string{"soft_lockup"}},
+		{"rcu: INFO: rcu_sched self-detected stall on CPU", []string{"soft_lockup"}},
+		{"blk_update_request: I/O error, dev sdb, sector 1234 op 0x0:(READ)", []string{"io_error"}},
+		{"sd 0:0:1:0: [sdb] tag#0 Sense Key : Medium Error [current]", []string{"io_error"}},
+		{"NETDEV WATCHDOG: eth0 (ixgbe): transmit queue 3 timed out", []string{"nic_reset"}},
+		{"e1000e 0000:00:19.0 eth0: Detected Hardware Unit Hang: Tx Unit Hang", []string{"nic_reset"}},
+		{"XFS (sdb1): Mounting V5 Filesystem", []string{}},
+		{"task xrootd blocked for more than a while", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			kp := newTestPlugin(t, defaultPatterns)
+			matched := kp.handle(time.Now(), kmsg.Record{Message: tt.message})
+			got := make([]string, 0)
+			for _, p := range kp.patterns {
+				if len(p.hits) > 0 {
+					got = append(got, p.Name)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) || matched != (len(tt.want) > 0) {
+				t.Errorf("got %v (matched %t), want %v", got, matched, tt.want)
+			}
+			if matched && len(kp.events) != 1 {
+				t.Errorf("got %d events kept, want 1", len(kp.events))
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	configs := []PatternConfig{
+		{Name: "hung_task", Pattern: "blocked", State: "FAIL", Window: 60},
+		{Name: "io_error", Pattern: "I/O error", State: "WARN", Threshold: 2, Window: 60},
+	}
+	tests := []struct {
+		name       string
+		hits       map[string][]time.Duration // pattern to how long ago it matched, oldest first
+		readErr    error
+		want       common.HealthState
+		wantDetail string
+	}{
+		{name: "nothing", want: common.StateOK, wantDetail: "No kernel trouble"},
+		{name: "single hit trips", hits: map[string][]time.Duration{"hung_task": {time.Second}}, want: common.StateFAIL, wantDetail: "hung_task: 1 kernel messages in 60s"},
+		{name: "hit outside the window", hits: map[string][]time.Duration{"hung_task": {2 * time.Minute}}, want: common.StateOK},
+		{name: "at the threshold", hits: map[string][]time.Duration{"io_error": {2 * time.Second, time.Second}}, want: common.StateOK},
+		{name: "above the threshold", hits: map[string][]time.Duration{"io_error": {3 * time.Second, 2 * time.Second, time.Second}}, want: common.StateWARN, wantDetail: "io_error: 3 kernel messages"},
+		{name: "expired hits not counted", hits: map[string][]time.Duration{"io_error": {2 * time.Minute, 90 * time.Second, 2 * time.Second, time.Second}}, want: common.StateOK},
+		{name: "worst pattern wins", hits: map[string][]time.Duration{"hung_task": {time.Second}, "io_error": {time.Second, time.Second, time.Second}}, want: common.StateFAIL, wantDetail: "io_error: 3"},
+		{name: "read error", readErr: os.ErrPermission, want: common.StateERROR, wantDetail: "reading " + kmsg.Path},
+		{name: "tripped pattern over a read error", hits: map[string][]time.Duration{"hung_task": {time.Second}}, readErr: os.ErrPermission, want: common.StateFAIL, wantDetail: "; reading " + kmsg.Path},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kp := newTestPlugin(t, configs)
+			kp.readErr = tt.readErr
+			for _, p := range kp.patterns {
+				for _, ago := range tt.hits[p.Name] {
+					p.hits = append(p.hits, now.Add(-ago))
+				}
+			}
+			got := kp.evaluate(now)
+			if got.State != tt.want || !strings.Contains(got.Detail, tt.wantDetail) || got.Name != "kernel" {
+				t.Errorf("got %s %s %q, want %s %q", got.Name, got.StateString, got.Detail,
+					common.HealthStateString(tt.want), tt.wantDetail)
+			}
+		})
+	}
+}
+
+func TestStartKeepsRetrying(t *testing.T) {
+	previous := kmsg.Path
+	t.Cleanup(func() { kmsg.Path = previous })
+	kmsg.Path = filepath.Join(t.TempDir(), "kmsg")
+
+	kp := newTestPlugin(t, defaultPatterns)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := make(chan common.HealthStatus, 10)
+	done := make(chan error, 1)
+	go func() { done <- kp.Start(ctx, updates) }()
+
+	select {
+	case got := <-updates:
+		if got.State != common.StateERROR || !strings.Contains(got.Detail, "reading "+kmsg.Path) {
+			t.Errorf("got %s %s, want the read error", got.StateString, got.Detail)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no update for the missing kmsg")
+	}
+	// Start waits to retry rather than returning
+	select {
+	case err := <-done:
+		t.Fatalf("Start returned %v after a failed follow", err)
+	case <-time.After(1500 * time.Millisecond):
+	}
+	kp.mu.Lock()
+	if !errors.Is(kp.readErr, os.ErrNotExist) {
+		t.Errorf("got read error %v, want the retry to fail again", kp.readErr)
+	}
+	kp.mu.Unlock()
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("got %v once stopped", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start did not return once stopped")
+	}
+}
@@ -0,0 +1,341 @@
+package logtail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.cern.ch/eos/argeos/config"
+	"gitlab.cern.ch/eos/argeos/internal/common"
+	"gitlab.cern.ch/eos/argeos/internal/logger"
+	"gitlab.cern.ch/eos/argeos/pkg/plugin"
+)
+
+// RuleConfig trips when Pattern matches more than Threshold lines within
+// Window seconds, reporting State (WARN or FAIL).
+type RuleConfig struct {
+	Name      string `json:"name"`
+	Pattern   string `json:"pattern"`
+	Threshold int    `json:"threshold"`
+	Window    int32  `json:"window"`
+	State     string `json:"state"`
+}
+
+type FileConfig struct {
+	Path        string       `json:"path"`
+	Rules       []RuleConfig `json:"rules"`
+	DumpLines   int          `json:"dump_lines"`
+	DumpMinutes int          `json:"dump_minutes"`
+}
+
+// PluginConfig PollInterval is in seconds
+type PluginConfig struct {
+	Files        []FileConfig `json:"files"`
+	PollInterval int32        `json:"poll_interval"`
+}
+
+const (
+	DefaultPollInterval = 1
+	DefaultRuleWindow   = 60
+	DefaultDumpLines    = 1000
+	DefaultDumpMinutes  = 10
+	// bound on the lines kept in memory for the last DumpMinutes
+	maxRecentLines = 100000
+)
+
+type rule struct {
+	RuleConfig
+	re    *regexp.Regexp
+	state common.HealthState
+	hits  []time.Time
+}
+
+type logLine struct {
+	at   time.Time
+	line string
+}
+
+type watchedFile struct {
+	FileConfig
+	tailer tailer
+	rules  []*rule
+	recent []logLine
+	err    error
+}
+
+type LogTailPlugin struct {
+	name        string
+	commandHelp map[string]plugin.Command
+
+	mu           sync.Mutex // guards files
+	files        []*watchedFile
+	pollInterval time.Duration
+}
+
+func newRule(cfg RuleConfig) (*rule, error) {
+	re, err := regexp.Compile(cfg.Pattern)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultRuleWindow
+	}
+	if cfg.Name == "" {
+		cfg.Name = cfg.Pattern
+	}
+	state := common.StateWARN
+	if cfg.State != "" {
+		var ok bool
+		if state, ok = common.HealthStateFromString(strings.ToUpper(cfg.State)); !ok {
+			return nil, fmt.Errorf("invalid state %q", cfg.State)
+		}
+	}
+	return &rule{RuleConfig: cfg, re: re, state: state}, nil
+}
+
+func NewPlugin(cfg config.Config) plugin.Plugin {
+	var pluginConfig PluginConfig
+	if err := plugin.DecodeConfig(cfg, "logtail", &pluginConfig); err != nil {
+		logger.Logger.Error("Error decoding logtail plugin config", "error", err)
+	}
+	if pluginConfig.PollInterval <= 0 {
+		pluginConfig.PollInterval = DefaultPollInterval
+	}
+
+	files := make([]*watchedFile, 0, len(pluginConfig.Files))
+	for _, fileConfig := range pluginConfig.Files {
+		if fileConfig.DumpLines <= 0 {
+			fileConfig.DumpLines = DefaultDumpLines
+		}
+		if fileConfig.DumpMinutes <= 0 {
+			fileConfig.DumpMinutes = DefaultDumpMinutes
+		}
+		wf := &watchedFile{FileConfig: fileConfig, tailer: tailer{path: fileConfig.Path}}
+		for _, ruleConfig := range fileConfig.Rules {
+			r, err := newRule(ruleConfig)
+			if err != nil {
+				logger.Logger.Error("Invalid log rule, skipping", "file", fileConfig.Path, "rule", ruleConfig.Name, "error", err)
+				continue
+			}
+			wf.rules = append(wf.rules, r)
+		}
+		files = append(files, wf)
+	}
+
+	return &LogTailPlugin{
+		name: "logtail",
+		commandHelp: map[string]plugin.Command{
+			"log_status":      {Description: "Show the rule matches of the tailed log files"},
+			"diagnostic_dump": {Description: "Dump the last lines and minutes of the tailed log files", Args: []plugin.Arg{plugin.DumpDirArg}},
+		},
+		files:        files,
+		pollInterval: time.Duration(pluginConfig.PollInterval) * time.Second,
+	}
+}
+
+func (lp *LogTailPlugin) Name() string {
+	return lp.name
+}
+
+func (lp *LogTailPlugin) CommandHelp() map[string]plugin.Command {
+	return lp.commandHelp
+}
+
+func prune(hits []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(hits) && hits[i].Before(cutoff) {
+		i++
+	}
+	return hits[i:]
+}
+
+func (wf *watchedFile) handleLine(now time.Time, line string) {
+	wf.recent = append(wf.recent, logLine{at: now, line: line})
+	for _, r := range wf.rules {
+		if r.re.MatchString(line) {
+			r.hits = append(r.hits, now)
+		}
+	}
+}
+
+func (wf *watchedFile) expire(now time.Time) {
+	cutoff := now.Add(-time.Duration(wf.DumpMinutes) * time.Minute)
+	i := 0
+	for i < len(wf.recent) && wf.recent[i].at.Before(cutoff) {
+		i++
+	}
+	i = max(i, len(wf.recent)-maxRecentLines)
+	wf.recent = wf.recent[i:]
+	for _, r := range wf.rules {
+		r.hits = prune(r.hits, now.Add(-time.Duration(r.Window)*time.Second))
+	}
+}
+
+func (lp *LogTailPlugin) poll() {
+	now := time.Now()
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+	for _, wf := range lp.files {
+		wf.err = wf.tailer.poll(func(line string) { wf.handleLine(now, line) })
+		if wf.err != nil {
+			logger.Logger.Debug("Error tailing log file", "file", wf.Path, "error", wf.err)
+		}
+		wf.expire(now)
+	}
+}
+
+// evaluate reports the worst tripped rule, listing all of them. Files that
+// cannot be read only make an ERROR when no rule tripped.
+func (lp *LogTailPlugin) evaluate() common.HealthStatus {
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+
+	worst := common.StateOK
+	problems := make([]string, 0)
+	for _, wf := range lp.files {
+		if wf.err != nil && !os.IsNotExist(wf.err) {
+			problems = append(problems, fmt.Sprintf("%s: %s", wf.Path, wf.err))
+		}
+		for _, r := range wf.rules {
+			if len(r.hits) > r.Threshold {
+				worst = common.WorseState(worst, r.state)
+				problems = append(problems, fmt.Sprintf("%s: %s matched %d lines in %ds (threshold %d)",
+					wf.Path, r.Name, len(r.hits), r.Window, r.Threshold))
+			}
+		}
+	}
+	if len(problems) == 0 {
+		return common.HealthOK(fmt.Sprintf("No rule tripped on %d files", len(lp.files))).WithComponent(lp.name)
+	}
+	if worst == common.StateOK {
+		worst = common.StateERROR
+	}
+	return common.HealthStatus{
+		State:       worst,
+		StateString: common.HealthStateString(worst),
+		Name:        lp.name,
+		Detail:      strings.Join(problems, "; "),
+	}
+}
+
+func (lp *LogTailPlugin) HealthCheck() common.HealthStatus {
+	if len(lp.files) == 0 {
+		return common.HealthWARN("No log files configured")
+	}
+	return lp.evaluate()
+}
+
+func (lp *LogTailPlugin) Start(ctx context.Context, updateChannel chan<- common.HealthStatus) error {
+	if len(lp.files) == 0 {
+		logger.Logger.Warn("No log files configured, not tailing")
+		return nil
+	}
+
+	lp.mu.Lock()
+	for _, wf := range lp.files {
+		if err := wf.tailer.open(true); err != nil {
+			logger.Logger.Warn("Log file not readable yet", "file", wf.Path, "error", err)
+		}
+	}
+	lp.mu.Unlock()
+	defer func() {
+		lp.mu.Lock()
+		for _, wf := range lp.files {
+			wf.tailer.close()
+		}
+		lp.mu.Unlock()
+	}()
+
+	logger.Logger.Info("Starting log tailer", "files", len(lp.files))
+	ticker := time.NewTicker(lp.pollInterval)
+	defer ticker.Stop()
+	previous := common.StateOK
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Logger.Info("Log tailer stopped")
+			return nil
+		case <-ticker.C:
+			lp.poll()
+			status := lp.evaluate()
+			if status.State != previous {
+				updateChannel <- status
+			}
+			previous = status.State
+		}
+	}
+}
+
+func (lp *LogTailPlugin) Stop() {
+	logger.Logger.Info("Stopping log tailer")
+}
+
+func dumpName(path string) string {
+	return strings.ReplaceAll(strings.TrimPrefix(filepath.Clean(path), "/"), "/", "_")
+}
+
+func (lp *LogTailPlugin) diagnosticDump(dumpDir string) (string, error) {
+	logsDir := filepath.Join(dumpDir, "logs")
+	if err := os.MkdirAll(logsDir, 0755); err != nil {
+		return "", err
+	}
+
+	lp.mu.Lock()
+	recent := make(map[string][]logLine, len(lp.files))
+	for _, wf := range lp.files {
+		recent[wf.Path] = append([]logLine(nil), wf.recent...)
+	}
+	lp.mu.Unlock()
+
+	for _, wf := range lp.files {
+		name := dumpName(wf.Path)
+		data, err := lastLines(wf.Path, wf.DumpLines)
+		if err != nil {
+			data = []byte(fmt.Sprintf("error: %s\n", err))
+		}
+		if err := os.WriteFile(filepath.Join(logsDir, name+".tail"), data, 0644); err != nil {
+			logger.Logger.Error("Error writing log tail", "file", wf.Path, "error", err)
+		}
+
+		// the lines of the last DumpMinutes as seen by the tailer, prefixed
+		// with the time we read them
+		var out strings.Builder
+		for _, l := range recent[wf.Path] {
+			fmt.Fprintf(&out, "%s %s\n", l.at.Format(time.RFC3339), l.line)
+		}
+		if err := os.WriteFile(filepath.Join(logsDir, name+".recent"), []byte(out.String()), 0644); err != nil {
+			logger.Logger.Error("Error writing recent log lines", "file", wf.Path, "error", err)
+		}
+	}
+	return fmt.Sprintf("logtail: dumped %d files", len(lp.files)), nil
+}
+
+func (lp *LogTailPlugin) Execute(command string, args ...string) (string, error) {
+	switch command {
+	case "log_status":
+		lp.mu.Lock()
+		defer lp.mu.Unlock()
+		var out strings.Builder
+		for _, wf := range lp.files {
+			if wf.err != nil {
+				fmt.Fprintf(&out, "%s: %s\n", wf.Path, wf.err)
+			}
+			for _, r := range wf.rules {
+				fmt.Fprintf(&out, "%s: %s %d/%d matches in %ds\n", wf.Path, r.Name, len(r.hits), r.Threshold, r.Window)
+			}
+		}
+		return out.String(), nil
+	case "diagnostic_dump":
+		if len(args) < 1 {
+			return "", fmt.Errorf("no diagnostic directory provided")
+		}
+		return lp.diagnosticDump(args[0])
+	default:
+		return "", fmt.Errorf("command not implemented")
+	}
+}
@@ -0,0 +1,175 @@
+package logtail
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"syscall"
+)
+
+// tailer follows a file by polling, like tail -F: it reopens the file when it
+// gets rotated (new inode) or truncated, after reading what is left of the
+// old one.
+type tailer struct {
+	path    string
+	file    *os.File
+	inode   uint64
+	offset  int64
+	partial []byte
+	// the line being read was already emitted truncated, drop the rest of it
+	discarding bool
+}
+
+const (
+	readChunk = 64 << 10
+	// longer lines are cut there, so that a line that never ends, like a
+	// binary file, does not grow partial without bound
+	maxLineLength = 64 << 10
+)
+
+func inodeOf(info os.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return st.Ino
+	}
+	return 0
+}
+
+// open starts following the file, from its end when fromEnd is set
+func (t *tailer) open(fromEnd bool) error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	t.offset = 0
+	if fromEnd {
+		t.offset = info.Size()
+	}
+	if _, err := f.Seek(t.offset, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+	t.file = f
+	t.inode = inodeOf(info)
+	t.partial = nil
+	t.discarding = false
+	return nil
+}
+
+func (t *tailer) close() {
+	if t.file != nil {
+		t.file.Close()
+		t.file = nil
+	}
+}
+
+func (t *tailer) readLines(emit func(line string)) error {
+	buf := make([]byte, readChunk)
+	for {
+		n, err := t.file.Read(buf)
+		if n > 0 {
+			t.offset += int64(n)
+			data := append(t.partial, buf[:n]...)
+			for {
+				i := bytes.IndexByte(data, '\n')
+				if i < 0 {
+					break
+				}
+				if !t.discarding {
+					emit(string(data[:min(i, maxLineLength)]))
+				}
+				t.discarding = false
+				data = data[i+1:]
+			}
+			if t.discarding {
+				data = nil
+			} else if len(data) >= maxLineLength {
+				emit(string(data[:maxLineLength]))
+				data = nil
+				t.discarding = true
+			}
+			t.partial = append([]byte(nil), data...)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// poll emits the lines added since the last poll
+func (t *tailer) poll(emit func(line string)) error {
+	if t.file == nil {
+		// the file did not exist when we started or got rotated away, any
+		// content it has now is new
+		if err := t.open(false); err != nil {
+			return err
+		}
+	}
+	if err := t.readLines(emit); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(t.path)
+	if err != nil {
+		// rotated and not recreated yet
+		t.close()
+		return nil
+	}
+	if inodeOf(info) != t.inode || info.Size() < t.offset {
+		t.close()
+		if err := t.open(false); err != nil {
+			return err
+		}
+		return t.readLines(emit)
+	}
+	return nil
+}
+
+// lastLines returns the last n lines of the file
+func lastLines(path string, n int) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	end := info.Size()
+	pos := end
+	var data []byte
+	for pos > 0 {
+		size := int64(readChunk)
+		if pos < size {
+			size = pos
+		}
+		pos -= size
+		chunk := make([]byte, size)
+		if _, err := f.ReadAt(chunk, pos); err != nil && err != io.EOF {
+			return nil, err
+		}
+		data = append(chunk, data...)
+		// one more newline than lines wanted, as the file ends with one
+		if bytes.Count(data, []byte{'\n'}) > n {
+			break
+		}
+	}
+
+	lines := bytes.SplitAfter(data, []byte{'\n'})
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return bytes.Join(lines, nil), nil
+}
@@ -0,0 +1,145 @@
+package logtail
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func appendFile(t *testing.T, path string, content string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func pollLines(t *testing.T, tl *tailer) []string {
+	t.Helper()
+	lines := make([]string, 0)
+	if err := tl.poll(func(line string) { lines = append(lines, line) }); err != nil {
+		t.Fatal(err)
+	}
+	return lines
+}
+
+func TestTailer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "eos.log")
+	appendFile(t, path, "before start\n")
+	tl := &tailer{path: path}
+	if err := tl.open(true); err != nil {
+		t.Fatal(err)
+	}
+	defer tl.close()
+
+	steps := []struct {
+		name   string
+		change func()
+		want   []string
+	}{
+		{"nothing new", func() {}, []string{}},
+		{"appended", func() { appendFile(t, path, "one\ntwo\n") }, []string{"one", "two"}},
+		{"partial line kept", func() { appendFile(t, path, "thr") }, []string{}},
+		{"partial line completed", func() { appendFile(t, path, "ee\n") }, []string{"three"}},
+		{"rotated", func() {
+			appendFile(t, path, "last of old\n")
+			if err := os.Rename(path, path+".1"); err != nil {
+				t.Fatal(err)
+			}
+			appendFile(t, path, "first of new\n")
+		}, []string{"last of old", "first of new"}},
+		{"removed", func() {
+			if err := os.Remove(path); err != nil {
+				t.Fatal(err)
+			}
+		}, []string{}},
+		{"recreated", func() { appendFile(t, path, "recreated\n") }, []string{"recreated"}},
+		{"truncated", func() {
+			if err := os.Truncate(path, 0); err != nil {
+				t.Fatal(err)
+			}
+			appendFile(t, path, "x\n")
+		}, []string{"x"}},
+	}
+	for _, step := range steps {
+		step.change()
+		if got := pollLines(t, tl); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%s: got %q, want %q", step.name, got, step.want)
+		}
+	}
+}
+
+func TestTailerLongLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "eos.log")
+	appendFile(t, path, "")
+	tl := &tailer{path: path}
+	if err := tl.open(true); err != nil {
+		t.Fatal(err)
+	}
+	defer tl.close()
+
+	long := strings.Repeat("x", maxLineLength)
+	steps := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"line at the cap", long + "\n", []string{long}},
+		{"complete line past the cap", long + "yyy\nshort\n", []string{long, "short"}},
+		{"line that never ends", long + "zzz", []string{long}},
+		{"more of it dropped", strings.Repeat("z", 3*readChunk), []string{}},
+		{"until it ends", "zzz\nnext\n", []string{"next"}},
+	}
+	for _, step := range steps {
+		appendFile(t, path, step.content)
+		got := pollLines(t, tl)
+		if !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%s: got %d lines, want %d", step.name, len(got), len(step.want))
+		}
+		if len(tl.partial) >= maxLineLength {
+			t.Errorf("%s: kept %d bytes of partial line", step.name, len(tl.partial))
+		}
+	}
+}
+
+func TestTailerMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "eos.log")
+	tl := &tailer{path: path}
+	defer tl.close()
+	if err := tl.poll(func(string) {}); !os.IsNotExist(err) {
+		t.Fatalf("got %v, want a not exist error", err)
+	}
+	appendFile(t, path, "created\n")
+	if got := pollLines(t, tl); !reflect.DeepEqual(got, []string{"created"}) {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestLastLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "eos.log")
+	appendFile(t, path, "a\nb\nc\n")
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{1, "c\n"},
+		{2, "b\nc\n"},
+		{3, "a\nb\nc\n"},
+		{10, "a\nb\nc\n"},
+	}
+	for _, tt := range tests {
+		got, err := lastLines(path, tt.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("lastLines(%d): got %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
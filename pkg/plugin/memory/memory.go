@@ -0,0 +1,359 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.cern.ch/eos/argeos/config"
+	"gitlab.cern.ch/eos/argeos/internal/common"
+	"gitlab.cern.ch/eos/argeos/internal/kmsg"
+	"gitlab.cern.ch/eos/argeos/internal/logger"
+	"gitlab.cern.ch/eos/argeos/internal/procfs"
+	"gitlab.cern.ch/eos/argeos/pkg/plugin"
+)
+
+// Threshold applies to one PSI line ("some" or "full") and average (avg10,
+// avg60 or avg300) of a resource, Warn and Fail are percentages of time
+// stalled. A zero Warn or Fail disables that level.
+type Threshold struct {
+	Line    string  `json:"line"`
+	Average string  `json:"average"`
+	Warn    float64 `json:"warn"`
+	Fail    float64 `json:"fail"`
+}
+
+// PluginConfig Pressure is keyed by resource: cpu, memory or io. OOMState is
+// reported for OOMWindow seconds after an OOM kill. CheckInterval is in
+// seconds.
+type PluginConfig struct {
+	Pressure      map[string]Threshold `json:"pressure"`
+	OOMState      string               `json:"oom_state"`
+	OOMWindow     int32                `json:"oom_window"`
+	CheckInterval int32                `json:"check_interval"`
+}
+
+const (
+	DefaultCheckInterval = 10
+	DefaultOOMWindow     = 3600
+)
+
+var resources = []string{"cpu", "memory", "io"}
+
+var defaultThresholds = map[string]Threshold{
+	"cpu":    {Line: "some", Average: "avg60", Warn: 80},
+	"memory": {Line: "full", Average: "avg60", Warn: 10, Fail: 40},
+	"io":     {Line: "full", Average: "avg60", Warn: 30, Fail: 70},
+}
+
+// oomPatterns match the kernel messages of the OOM killer, both global and
+// cgroup ones
+var oomPatterns = []string{"invoked oom-killer", "Out of memory", "oom-kill:", "Killed process", "oom_reaper"}
+
+// meminfoFields are the lines of meminfo shown by memory_status
+var meminfoFields = []string{"MemTotal", "MemAvailable", "Cached", "Dirty", "Writeback", "SwapTotal", "SwapFree", "Slab"}
+
+type MemoryPlugin struct {
+	name          string
+	commandHelp   map[string]plugin.Command
+	thresholds    map[string]Threshold
+	oomState      common.HealthState
+	oomWindow     time.Duration
+	checkInterval time.Duration
+
+	mu       sync.Mutex // guards the OOM tracking
+	oomKills uint64
+	oomSeen  bool
+	lastOOM  time.Time
+}
+
+func NewPlugin(cfg config.Config) plugin.Plugin {
+	var pluginConfig PluginConfig
+	if err := plugin.DecodeConfig(cfg, "memory", &pluginConfig); err != nil {
+		logger.Logger.Error("Error decoding memory plugin config", "error", err)
+	}
+	if pluginConfig.CheckInterval <= 0 {
+		pluginConfig.CheckInterval = DefaultCheckInterval
+	}
+	if pluginConfig.OOMWindow <= 0 {
+		pluginConfig.OOMWindow = DefaultOOMWindow
+	}
+	oomState := common.StateWARN
+	if pluginConfig.OOMState != "" {
+		state, ok := common.HealthStateFromString(strings.ToUpper(pluginConfig.OOMState))
+		if !ok {
+			logger.Logger.Error("Invalid oom_state, using WARN", "oom_state", pluginConfig.OOMState)
+		} else {
+			oomState = state
+		}
+	}
+
+	thresholds := make(map[string]Threshold, len(resources))
+	for _, resource := range resources {
+		threshold, ok := pluginConfig.Pressure[resource]
+		if !ok {
+			threshold = defaultThresholds[resource]
+		}
+		if threshold.Line == "" {
+			threshold.Line = defaultThresholds[resource].Line
+		}
+		if threshold.Average == "" {
+			threshold.Average = defaultThresholds[resource].Average
+		}
+		thresholds[resource] = threshold
+	}
+	for resource := range pluginConfig.Pressure {
+		if _, ok := defaultThresholds[resource]; !ok {
+			logger.Logger.Error("Unknown pressure resource, ignoring", "resource", resource)
+		}
+	}
+
+	return &MemoryPlugin{
+		name: "memory",
+		commandHelp: map[string]plugin.Command{
+			"memory_status":   {Description: "Show pressure stall information, memory usage and OOM kills"},
+			"oom_kills":       {Description: "Show the OOM killer messages in the kernel log"},
+			"diagnostic_dump": {Description: "Dump pressure, meminfo, vmstat and OOM kill messages", Args: []plugin.Arg{plugin.DumpDirArg}},
+		},
+		thresholds:    thresholds,
+		oomState:      oomState,
+		oomWindow:     time.Duration(pluginConfig.OOMWindow) * time.Second,
+		checkInterval: time.Duration(pluginConfig.CheckInterval) * time.Second,
+	}
+}
+
+func (mp *MemoryPlugin) Name() string {
+	return mp.name
+}
+
+func (mp *MemoryPlugin) CommandHelp() map[string]plugin.Command {
+	return mp.commandHelp
+}
+
+func average(p procfs.Pressure, name string) float64 {
+	switch name {
+	case "avg10":
+		return p.Avg10
+	case "avg300":
+		return p.Avg300
+	default:
+		return p.Avg60
+	}
+}
+
+// pressureHealth checks one resource against its threshold
+func (mp *MemoryPlugin) pressureHealth(resource string) common.HealthStatus {
+	threshold := mp.thresholds[resource]
+	pressure, err := procfs.ReadPressure(resource)
+	if os.IsNotExist(err) {
+		// kernel without PSI, or booted with psi=0
+		return common.HealthOK(fmt.Sprintf("%s pressure not available", resource))
+	}
+	if err != nil {
+		return common.HealthERROR(fmt.Sprintf("%s pressure: %s", resource, err))
+	}
+	p, ok := pressure[threshold.Line]
+	if !ok {
+		return common.HealthOK(fmt.Sprintf("%s pressure: no %s line", resource, threshold.Line))
+	}
+	value := average(p, threshold.Average)
+	detail := fmt.Sprintf("%s %s %s=%.2f%%", resource, threshold.Line, threshold.Average, value)
+	switch {
+	case threshold.Fail > 0 && value >= threshold.Fail:
+		return common.HealthFAIL(detail)
+	case threshold.Warn > 0 && value >= threshold.Warn:
+		return common.HealthWARN(detail)
+	default:
+		return common.HealthOK(detail)
+	}
+}
+
+// oomHealth follows the oom_kill counter of vmstat, which is cheaper than
+// going through the kernel log on every check
+func (mp *MemoryPlugin) oomHealth(now time.Time) common.HealthStatus {
+	vmstat, err := procfs.Vmstat()
+	if err != nil {
+		return common.HealthERROR(fmt.Sprintf("vmstat: %s", err))
+	}
+	kills, ok := vmstat["oom_kill"]
+	if !ok {
+		return common.HealthOK("oom_kill counter not available")
+	}
+
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	if mp.oomSeen && kills > mp.oomKills {
+		logger.Logger.Warn("OOM kill detected", "kills", kills-mp.oomKills)
+		mp.lastOOM = now
+	}
+	mp.oomKills = kills
+	mp.oomSeen = true
+
+	if !mp.lastOOM.IsZero() && now.Sub(mp.lastOOM) < mp.oomWindow {
+		return common.HealthStatus{
+			State:       mp.oomState,
+			StateString: common.HealthStateString(mp.oomState),
+			Detail:      fmt.Sprintf("OOM kill %s ago, %d since boot", now.Sub(mp.lastOOM).Round(time.Second), kills),
+		}
+	}
+	return common.HealthOK(fmt.Sprintf("%d OOM kills since boot", kills))
+}
+
+func (mp *MemoryPlugin) HealthCheck() common.HealthStatus {
+	statuses := make([]common.HealthStatus, 0, len(resources)+1)
+	for _, resource := range resources {
+		statuses = append(statuses, mp.pressureHealth(resource))
+	}
+	statuses = append(statuses, mp.oomHealth(time.Now()))
+
+	worst := common.HealthOK("")
+	details := make([]string, 0, len(statuses))
+	for _, status := range statuses {
+		if common.WorseState(worst.State, status.State) != worst.State {
+			worst = status
+		}
+		details = append(details, status.Detail)
+	}
+	worst.Detail = strings.Join(details, "; ")
+	return worst.WithComponent(mp.name)
+}
+
+func (mp *MemoryPlugin) Start(ctx context.Context, updateChannel chan<- common.HealthStatus) error {
+	logger.Logger.Info("Starting memory pressure monitor", "interval", mp.checkInterval)
+	// take the OOM counter baseline, kills before we started are not news
+	mp.oomHealth(time.Now())
+
+	ticker := time.NewTicker(mp.checkInterval)
+	defer ticker.Stop()
+	previous := common.StateOK
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Logger.Info("Memory pressure monitor stopped")
+			return nil
+		case <-ticker.C:
+			status := mp.HealthCheck()
+			if status.State != previous {
+				updateChannel <- status
+			}
+			previous = status.State
+		}
+	}
+}
+
+func (mp *MemoryPlugin) Stop() {
+	logger.Logger.Info("Stopping memory pressure monitor")
+}
+
+func isOOMMessage(message string) bool {
+	for _, pattern := range oomPatterns {
+		if strings.Contains(message, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// oomMessages returns the OOM killer messages still in the kernel ring buffer
+func oomMessages() (string, error) {
+	records, err := kmsg.ReadAll()
+	if err != nil && len(records) == 0 {
+		return "", err
+	}
+	matched := make([]kmsg.Record, 0)
+	for _, record := range records {
+		if isOOMMessage(record.Message) {
+			matched = append(matched, record)
+		}
+	}
+	return kmsg.Format(matched), nil
+}
+
+func (mp *MemoryPlugin) status() string {
+	var out strings.Builder
+	for _, resource := range resources {
+		pressure, err := procfs.ReadPressure(resource)
+		if err != nil {
+			fmt.Fprintf(&out, "%s: %s\n", resource, err)
+			continue
+		}
+		lines := make([]string, 0, len(pressure))
+		for line := range pressure {
+			lines = append(lines, line)
+		}
+		sort.Strings(lines)
+		for _, line := range lines {
+			p := pressure[line]
+			fmt.Fprintf(&out, "%s %s avg10=%.2f avg60=%.2f avg300=%.2f\n", resource, line, p.Avg10, p.Avg60, p.Avg300)
+		}
+	}
+
+	meminfo, err := procfs.Meminfo()
+	if err != nil {
+		fmt.Fprintf(&out, "meminfo: %s\n", err)
+	}
+	for _, field := range meminfoFields {
+		if value, ok := meminfo[field]; ok {
+			fmt.Fprintf(&out, "%s: %d MiB\n", field, value>>10)
+		}
+	}
+
+	out.WriteString(mp.oomHealth(time.Now()).Detail)
+	out.WriteByte('\n')
+	return out.String()
+}
+
+func (mp *MemoryPlugin) diagnosticDump(dumpDir string) (string, error) {
+	memoryDir := filepath.Join(dumpDir, "memory")
+	if err := os.MkdirAll(memoryDir, 0755); err != nil {
+		return "", err
+	}
+
+	files := map[string]string{
+		"meminfo":   filepath.Join(procfs.Root, "meminfo"),
+		"vmstat":    filepath.Join(procfs.Root, "vmstat"),
+		"buddyinfo": filepath.Join(procfs.Root, "buddyinfo"),
+	}
+	for _, resource := range resources {
+		files["pressure_"+resource] = filepath.Join(procfs.Root, "pressure", resource)
+	}
+	for name, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			data = []byte(fmt.Sprintf("error: %s\n", err))
+		}
+		if err := os.WriteFile(filepath.Join(memoryDir, name), data, 0644); err != nil {
+			logger.Logger.Error("Error writing memory dump file", "file", name, "error", err)
+		}
+	}
+
+	messages, err := oomMessages()
+	if err != nil {
+		messages = fmt.Sprintf("error: %s\n", err)
+	}
+	if err := os.WriteFile(filepath.Join(memoryDir, "oom_kills.txt"), []byte(messages), 0644); err != nil {
+		logger.Logger.Error("Error writing OOM kill messages", "error", err)
+	}
+	return fmt.Sprintf("memory: dumped %d files", len(files)+1), nil
+}
+
+func (mp *MemoryPlugin) Execute(command string, args ...string) (string, error) {
+	switch command {
+	case "memory_status":
+		return mp.status(), nil
+	case "oom_kills":
+		return oomMessages()
+	case "diagnostic_dump":
+		if len(args) < 1 {
+			return "", fmt.Errorf("no diagnostic directory provided")
+		}
+		return mp.diagnosticDump(args[0])
+	default:
+		return "", fmt.Errorf("command not implemented")
+	}
+}
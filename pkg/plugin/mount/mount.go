@@ -0,0 +1,374 @@
+package mount
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"gitlab.cern.ch/eos/argeos/config"
+	"gitlab.cern.ch/eos/argeos/internal/common"
+	"gitlab.cern.ch/eos/argeos/internal/logger"
+	"gitlab.cern.ch/eos/argeos/pkg/plugin"
+)
+
+// MountConfig thresholds are percentages of used space and inodes, Timeout
+// is in seconds. ProbeFile is the prefix of the write probe files, each
+// created with a random suffix.
+type MountConfig struct {
+	Path         string  `json:"path"`
+	Timeout      int32   `json:"timeout"`
+	WriteProbe   bool    `json:"write_probe"`
+	ProbeFile    string  `json:"probe_file"`
+	CapacityWarn float64 `json:"capacity_warn"`
+	CapacityFail float64 `json:"capacity_fail"`
+	InodeWarn    float64 `json:"inode_warn"`
+	InodeFail    float64 `json:"inode_fail"`
+}
+
+// PluginConfig CheckInterval is in seconds
+type PluginConfig struct {
+	Mounts        []MountConfig `json:"mounts"`
+	CheckInterval int32         `json:"check_interval"`
+}
+
+const (
+	DefaultCheckInterval = 30
+	DefaultProbeTimeout  = 10
+	DefaultCapacityWarn  = 90
+	DefaultCapacityFail  = 98
+	DefaultInodeWarn     = 90
+	DefaultInodeFail     = 98
+	probeFileName        = ".argeos_probe"
+)
+
+type probeResult struct {
+	capacity float64 // percent used
+	inodes   float64 // percent used
+	duration time.Duration
+	err      error
+}
+
+type MountPlugin struct {
+	name          string
+	commandHelp   map[string]plugin.Command
+	mounts        []MountConfig
+	checkInterval time.Duration
+
+	probe func(m MountConfig) probeResult
+
+	mu       sync.Mutex // guards inflight, last and checked
+	inflight map[string]time.Time
+	last     map[string]common.HealthStatus
+	checked  time.Time
+}
+
+func NewPlugin(cfg config.Config) plugin.Plugin {
+	var pluginConfig PluginConfig
+	if err := plugin.DecodeConfig(cfg, "mount", &pluginConfig); err != nil {
+		logger.Logger.Error("Error decoding mount plugin config", "error", err)
+	}
+	if pluginConfig.CheckInterval <= 0 {
+		pluginConfig.CheckInterval = DefaultCheckInterval
+	}
+	for i := range pluginConfig.Mounts {
+		m := &pluginConfig.Mounts[i]
+		if m.Timeout <= 0 {
+			m.Timeout = DefaultProbeTimeout
+		}
+		if m.ProbeFile == "" {
+			m.ProbeFile = filepath.Join(m.Path, probeFileName)
+		}
+		if m.CapacityWarn <= 0 {
+			m.CapacityWarn = DefaultCapacityWarn
+		}
+		if m.CapacityFail <= 0 {
+			m.CapacityFail = DefaultCapacityFail
+		}
+		if m.InodeWarn <= 0 {
+			m.InodeWarn = DefaultInodeWarn
+		}
+		if m.InodeFail <= 0 {
+			m.InodeFail = DefaultInodeFail
+		}
+	}
+
+	return &MountPlugin{
+		name: "mount",
+		commandHelp: map[string]plugin.Command{
+			"check_mounts":    {Description: "Probe the configured mountpoints"},
+			"diagnostic_dump": {Description: "Dump mountinfo and the last probe results", Args: []plugin.Arg{plugin.DumpDirArg}},
+		},
+		mounts:        pluginConfig.Mounts,
+		checkInterval: time.Duration(pluginConfig.CheckInterval) * time.Second,
+		probe:         probe,
+		inflight:      make(map[string]time.Time),
+		last:          make(map[string]common.HealthStatus),
+	}
+}
+
+func (mp *MountPlugin) Name() string {
+	return mp.name
+}
+
+func (mp *MountPlugin) CommandHelp() map[string]plugin.Command {
+	return mp.commandHelp
+}
+
+func usedPercent(total uint64, free uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(total-free) * 100 / float64(total)
+}
+
+// probe does the actual filesystem calls, any of which may hang forever on a
+// stuck FUSE or NFS mount.
+func probe(m MountConfig) probeResult {
+	start := time.Now()
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(m.Path, &st); err != nil {
+		return probeResult{err: fmt.Errorf("statfs: %w", err)}
+	}
+	result := probeResult{
+		capacity: usedPercent(st.Blocks, st.Bavail),
+		inodes:   usedPercent(st.Files, st.Ffree),
+	}
+
+	dir, err := os.Open(m.Path)
+	if err != nil {
+		result.err = fmt.Errorf("open: %w", err)
+		return result
+	}
+	_, err = dir.Readdirnames(1)
+	dir.Close()
+	if err != nil && err != io.EOF {
+		result.err = fmt.Errorf("readdir: %w", err)
+		return result
+	}
+
+	if m.WriteProbe {
+		result.err = writeProbe(m.ProbeFile)
+	}
+	result.duration = time.Since(start)
+	return result
+}
+
+// writeProbe writes to a new file named after prefix. Its name is random and
+// it is created exclusively, since users may be able to write to the mount:
+// a predictable name could be a symlink making root truncate any file.
+func writeProbe(prefix string) error {
+	content := []byte(time.Now().Format(time.RFC3339Nano))
+	f, err := os.CreateTemp(filepath.Dir(prefix), filepath.Base(prefix)+"-*")
+	if err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if _, err := f.Write(content); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("fsync: %w", err)
+	}
+	readBack := make([]byte, len(content))
+	if _, err := f.ReadAt(readBack, 0); err != nil {
+		return fmt.Errorf("read: %w", err)
+	}
+	if string(readBack) != string(content) {
+		return fmt.Errorf("read back %q, wrote %q", readBack, content)
+	}
+	return nil
+}
+
+// checkMount runs the probe in a goroutine so that a hung mount does not
+// wedge argeos. A probe still running from another check is not started
+// again: past the timeout the mount keeps failing until it returns, before
+// that the other check is still waiting for it and its last status stands.
+func (mp *MountPlugin) checkMount(m MountConfig) common.HealthStatus {
+	mp.mu.Lock()
+	if since, running := mp.inflight[m.Path]; running {
+		last, probed := mp.last[m.Path]
+		mp.mu.Unlock()
+		if running := time.Since(since); running >= time.Duration(m.Timeout)*time.Second {
+			return common.HealthFAIL(fmt.Sprintf("%s: probe hung for %s", m.Path, running.Round(time.Second)))
+		}
+		if probed {
+			return last
+		}
+		return common.HealthOK(fmt.Sprintf("%s: first probe in progress", m.Path))
+	}
+	mp.inflight[m.Path] = time.Now()
+	mp.mu.Unlock()
+
+	done := make(chan probeResult, 1)
+	go func() {
+		result := mp.probe(m)
+		mp.mu.Lock()
+		delete(mp.inflight, m.Path)
+		mp.mu.Unlock()
+		done <- result
+	}()
+
+	timer := time.NewTimer(time.Duration(m.Timeout) * time.Second)
+	defer timer.Stop()
+	var result probeResult
+	select {
+	case result = <-done:
+	case <-timer.C:
+		return common.HealthFAIL(fmt.Sprintf("%s: probe did not complete within %ds", m.Path, m.Timeout))
+	}
+
+	if result.err != nil {
+		return common.HealthFAIL(fmt.Sprintf("%s: %s", m.Path, result.err))
+	}
+	detail := fmt.Sprintf("%s: %.1f%% used, %.1f%% inodes used, probe took %s",
+		m.Path, result.capacity, result.inodes, result.duration.Round(time.Millisecond))
+	switch {
+	case result.capacity >= m.CapacityFail || result.inodes >= m.InodeFail:
+		return common.HealthFAIL(detail)
+	case result.capacity >= m.CapacityWarn || result.inodes >= m.InodeWarn:
+		return common.HealthWARN(detail)
+	default:
+		return common.HealthOK(detail)
+	}
+}
+
+// check probes all mounts concurrently, so one hung mount does not delay
+// the others, and rolls them up into the worst status.
+func (mp *MountPlugin) check() common.HealthStatus {
+	statuses := make([]common.HealthStatus, len(mp.mounts))
+	var wg sync.WaitGroup
+	for i, m := range mp.mounts {
+		wg.Add(1)
+		go func(i int, m MountConfig) {
+			defer wg.Done()
+			statuses[i] = mp.checkMount(m)
+		}(i, m)
+	}
+	wg.Wait()
+
+	mp.mu.Lock()
+	for i, status := range statuses {
+		mp.last[mp.mounts[i].Path] = status
+	}
+	mp.checked = time.Now()
+	mp.mu.Unlock()
+	return mp.rollup(statuses)
+}
+
+func (mp *MountPlugin) rollup(statuses []common.HealthStatus) common.HealthStatus {
+	worst := common.HealthOK("")
+	details := make([]string, 0, len(statuses))
+	for _, status := range statuses {
+		if common.WorseState(worst.State, status.State) != worst.State {
+			worst = status
+		}
+		details = append(details, status.Detail)
+	}
+	worst.Detail = strings.Join(details, "; ")
+	return worst.WithComponent(mp.name)
+}
+
+// HealthCheck reports the last probes while the prober keeps them fresh, so
+// that the periodic healthcheck does not probe concurrently with it
+func (mp *MountPlugin) HealthCheck() common.HealthStatus {
+	if len(mp.mounts) == 0 {
+		return common.HealthWARN("No mountpoints configured")
+	}
+	mp.mu.Lock()
+	fresh := time.Since(mp.checked) < mp.checkInterval
+	statuses := make([]common.HealthStatus, 0, len(mp.mounts))
+	for _, m := range mp.mounts {
+		statuses = append(statuses, mp.last[m.Path])
+	}
+	mp.mu.Unlock()
+	if fresh {
+		return mp.rollup(statuses)
+	}
+	return mp.check()
+}
+
+func (mp *MountPlugin) Start(ctx context.Context, updateChannel chan<- common.HealthStatus) error {
+	if len(mp.mounts) == 0 {
+		logger.Logger.Warn("No mountpoints configured, not probing")
+		return nil
+	}
+
+	logger.Logger.Info("Starting mount prober", "mounts", len(mp.mounts), "interval", mp.checkInterval)
+	ticker := time.NewTicker(mp.checkInterval)
+	defer ticker.Stop()
+	previous := common.StateOK
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Logger.Info("Mount prober stopped")
+			return nil
+		case <-ticker.C:
+			status := mp.check()
+			if status.State != common.StateOK || previous != common.StateOK {
+				updateChannel <- status
+			}
+			previous = status.State
+		}
+	}
+}
+
+func (mp *MountPlugin) Stop() {
+	logger.Logger.Info("Stopping mount prober")
+}
+
+// diagnosticDump only writes the results of the last probes, probing again
+// could block the dump on the very mount that is hung.
+func (mp *MountPlugin) diagnosticDump(dumpDir string) (string, error) {
+	mountDir := filepath.Join(dumpDir, "mount")
+	if err := os.MkdirAll(mountDir, 0755); err != nil {
+		return "", err
+	}
+
+	mountinfo, err := os.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		mountinfo = []byte(fmt.Sprintf("error: %s\n", err))
+	}
+	if err := os.WriteFile(filepath.Join(mountDir, "mountinfo"), mountinfo, 0644); err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	mp.mu.Lock()
+	for _, m := range mp.mounts {
+		if status, ok := mp.last[m.Path]; ok {
+			fmt.Fprintf(&out, "%s %s\n", status.StateString, status.Detail)
+		} else {
+			fmt.Fprintf(&out, "%s: not probed yet\n", m.Path)
+		}
+		if since, stuck := mp.inflight[m.Path]; stuck {
+			fmt.Fprintf(&out, "%s: probe in flight since %s\n", m.Path, since.Format(time.RFC3339))
+		}
+	}
+	mp.mu.Unlock()
+	if err := os.WriteFile(filepath.Join(mountDir, "probes.txt"), []byte(out.String()), 0644); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("mount: dumped %d mounts", len(mp.mounts)), nil
+}
+
+func (mp *MountPlugin) Execute(command string, args ...string) (string, error) {
+	switch command {
+	case "check_mounts":
+		status := mp.check()
+		return fmt.Sprintf("%s %s", status.StateString, strings.ReplaceAll(status.Detail, "; ", "\n")), nil
+	case "diagnostic_dump":
+		if len(args) < 1 {
+			return "", fmt.Errorf("no diagnostic directory provided")
+		}
+		return mp.diagnosticDump(args[0])
+	default:
+		return "", fmt.Errorf("command not implemented")
+	}
+}
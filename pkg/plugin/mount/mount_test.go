@@ -0,0 +1,147 @@
+package mount
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.cern.ch/eos/argeos/internal/common"
+	"gitlab.cern.ch/eos/argeos/internal/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	os.Exit(m.Run())
+}
+
+func TestWriteProbe(t *testing.T) {
+	dir := t.TempDir()
+	if err := writeProbe(filepath.Join(dir, probeFileName)); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("probe file left behind: %v", entries)
+	}
+}
+
+func TestWriteProbeIgnoresSymlink(t *testing.T) {
+	dir := t.TempDir()
+	victim := filepath.Join(t.TempDir(), "shadow")
+	if err := os.WriteFile(victim, []byte("keep me"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	prefix := filepath.Join(dir, probeFileName)
+	if err := os.Symlink(victim, prefix); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeProbe(prefix); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(victim); err != nil || string(data) != "keep me" {
+		t.Errorf("symlink target now holds %q, %v", data, err)
+	}
+}
+
+// newTestPlugin probes with blocked, which returns once released is closed
+func newTestPlugin(t *testing.T, released chan struct{}) (*MountPlugin, MountConfig) {
+	t.Helper()
+	m := MountConfig{Path: "/eos", Timeout: 1, CapacityWarn: 90, CapacityFail: 98, InodeWarn: 90, InodeFail: 98}
+	mp := &MountPlugin{
+		name:   "mount",
+		mounts: []MountConfig{m},
+		probe: func(m MountConfig) probeResult {
+			<-released
+			return probeResult{capacity: 50, inodes: 10}
+		},
+		inflight: make(map[string]time.Time),
+		last:     make(map[string]common.HealthStatus),
+	}
+	return mp, m
+}
+
+func TestCheckMountTimeout(t *testing.T) {
+	released := make(chan struct{})
+	mp, m := newTestPlugin(t, released)
+
+	status := mp.checkMount(m)
+	if status.State != common.StateFAIL || !strings.Contains(status.Detail, "did not complete within 1s") {
+		t.Errorf("got %s %s, want a timeout", status.StateString, status.Detail)
+	}
+	// the probe is still hung, and not started again
+	status = mp.checkMount(m)
+	if status.State != common.StateFAIL || !strings.Contains(status.Detail, "probe hung for") {
+		t.Errorf("got %s %s, want hung", status.StateString, status.Detail)
+	}
+
+	close(released)
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		mp.mu.Lock()
+		_, running := mp.inflight[m.Path]
+		mp.mu.Unlock()
+		if !running {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status := mp.checkMount(m); status.State != common.StateOK {
+		t.Errorf("got %s %s once the mount recovered", status.StateString, status.Detail)
+	}
+}
+
+func TestCheckMountInFlight(t *testing.T) {
+	last := common.HealthWARN("/eos: 95.0% used")
+	tests := []struct {
+		name       string
+		started    time.Duration // how long ago the probe in flight started
+		last       *common.HealthStatus
+		wantState  common.HealthState
+		wantDetail string
+	}{
+		{name: "first probe", started: 0, wantState: common.StateOK, wantDetail: "first probe in progress"},
+		{name: "last status stands", started: 0, last: &last, wantState: common.StateWARN, wantDetail: "95.0% used"},
+		{name: "hung past the timeout", started: 2 * time.Second, last: &last, wantState: common.StateFAIL, wantDetail: "probe hung for 2s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			released := make(chan struct{})
+			defer close(released)
+			mp, m := newTestPlugin(t, released)
+			mp.inflight[m.Path] = time.Now().Add(-tt.started)
+			if tt.last != nil {
+				mp.last[m.Path] = *tt.last
+			}
+			status := mp.checkMount(m)
+			if status.State != tt.wantState || !strings.Contains(status.Detail, tt.wantDetail) {
+				t.Errorf("got %s %s, want %s %s", status.StateString, status.Detail,
+					common.HealthStateString(tt.wantState), tt.wantDetail)
+			}
+		})
+	}
+}
+
+func TestCheckMountThresholds(t *testing.T) {
+	tests := []struct {
+		name   string
+		result probeResult
+		want   common.HealthState
+	}{
+		{"ok", probeResult{capacity: 50, inodes: 10}, common.StateOK},
+		{"capacity warn", probeResult{capacity: 91, inodes: 10}, common.StateWARN},
+		{"inodes fail", probeResult{capacity: 50, inodes: 99}, common.StateFAIL},
+		{"probe error", probeResult{err: os.ErrPermission}, common.StateFAIL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mp, m := newTestPlugin(t, nil)
+			mp.probe = func(MountConfig) probeResult { return tt.result }
+			if status := mp.checkMount(m); status.State != tt.want {
+				t.Errorf("got %s %s", status.StateString, status.Detail)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package network
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.cern.ch/eos/argeos/internal/procfs"
+)
+
+// readCounters parses the header/value line pairs of /proc/net/snmp and
+// netstat into "Group.Name" keys, like Tcp.RetransSegs
+func readCounters(name string) (map[string]int64, error) {
+	data, err := os.ReadFile(filepath.Join(procfs.Root, "net", name))
+	if err != nil {
+		return nil, err
+	}
+	counters := make(map[string]int64)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	for i := 0; i+1 < len(lines); i += 2 {
+		names := strings.Fields(lines[i])
+		values := strings.Fields(lines[i+1])
+		if len(names) != len(values) || len(names) == 0 || names[0] != values[0] {
+			return nil, fmt.Errorf("malformed %s near %q", name, lines[i])
+		}
+		group := strings.TrimSuffix(names[0], ":")
+		for j := 1; j < len(names); j++ {
+			value, err := strconv.ParseInt(values[j], 10, 64)
+			if err != nil {
+				continue
+			}
+			counters[group+"."+names[j]] = value
+		}
+	}
+	return counters, nil
+}
+
+// tcpCounters is a sample of the kernel TCP counters we compute rates of
+type tcpCounters struct {
+	at              time.Time
+	listenOverflows int64
+	listenDrops     int64
+	outSegs         int64
+	retransSegs     int64
+}
+
+func sampleTCPCounters() (tcpCounters, error) {
+	snmp, err := readCounters("snmp")
+	if err != nil {
+		return tcpCounters{}, err
+	}
+	netstat, err := readCounters("netstat")
+	if err != nil {
+		return tcpCounters{}, err
+	}
+	return tcpCounters{
+		at:              time.Now(),
+		listenOverflows: netstat["TcpExt.ListenOverflows"],
+		listenDrops:     netstat["TcpExt.ListenDrops"],
+		outSegs:         snmp["Tcp.OutSegs"],
+		retransSegs:     snmp["Tcp.RetransSegs"],
+	}, nil
+}
+
+// tcpRates are the counter increases between two samples, per minute for the
+// drops and as a percentage of the segments sent for retransmissions
+type tcpRates struct {
+	listenOverflows float64
+	synDrops        float64
+	outSegs         int64
+	retransPercent  float64
+}
+
+func (c tcpCounters) ratesSince(previous tcpCounters) tcpRates {
+	minutes := c.at.Sub(previous.at).Minutes()
+	if minutes <= 0 {
+		return tcpRates{}
+	}
+	rates := tcpRates{
+		listenOverflows: float64(c.listenOverflows-previous.listenOverflows) / minutes,
+		synDrops:        float64(c.listenDrops-previous.listenDrops) / minutes,
+		outSegs:         c.outSegs - previous.outSegs,
+	}
+	if rates.outSegs > 0 {
+		rates.retransPercent = float64(c.retransSegs-previous.retransSegs) * 100 / float64(rates.outSegs)
+	}
+	return rates
+}
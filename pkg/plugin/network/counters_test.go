@@ -0,0 +1,93 @@
+package network
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"gitlab.cern.ch/eos/argeos/internal/procfs"
+)
+
+func TestReadCounters(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]int64
+		wantErr bool
+	}{
+		{
+			name: "snmp",
+			content: "Ip: Forwarding DefaultTTL\nIp: 1 64\n" +
+				"Tcp: RtoAlgorithm ActiveOpens OutSegs RetransSegs\nTcp: 1 10 5000 25\n",
+			want: map[string]int64{"Ip.Forwarding": 1, "Ip.DefaultTTL": 64,
+				"Tcp.RtoAlgorithm": 1, "Tcp.ActiveOpens": 10, "Tcp.OutSegs": 5000, "Tcp.RetransSegs": 25},
+		},
+		{
+			name:    "netstat",
+			content: "TcpExt: ListenOverflows ListenDrops\nTcpExt: 3 4\n",
+			want:    map[string]int64{"TcpExt.ListenOverflows": 3, "TcpExt.ListenDrops": 4},
+		},
+		{
+			name:    "negative and unparsable values",
+			content: "Tcp: MaxConn Bogus\nTcp: -1 x\n",
+			want:    map[string]int64{"Tcp.MaxConn": -1},
+		},
+		{name: "column mismatch", content: "Tcp: A B\nTcp: 1\n", wantErr: true},
+		{name: "group mismatch", content: "Tcp: A\nUdp: 1\n", wantErr: true},
+	}
+	root := t.TempDir()
+	defer func(previous string) { procfs.Root = previous }(procfs.Root)
+	procfs.Root = root
+	if err := os.Mkdir(filepath.Join(root, "net"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(filepath.Join(root, "net", "snmp"), []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := readCounters("snmp")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRatesSince(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	previous := tcpCounters{at: start, listenOverflows: 10, listenDrops: 20, outSegs: 1000, retransSegs: 10}
+	tests := []struct {
+		name    string
+		current tcpCounters
+		want    tcpRates
+	}{
+		{
+			name:    "two minutes",
+			current: tcpCounters{at: start.Add(2 * time.Minute), listenOverflows: 14, listenDrops: 30, outSegs: 3000, retransSegs: 110},
+			want:    tcpRates{listenOverflows: 2, synDrops: 5, outSegs: 2000, retransPercent: 5},
+		},
+		{
+			name:    "no segments sent",
+			current: tcpCounters{at: start.Add(time.Minute), listenOverflows: 10, listenDrops: 20, outSegs: 1000, retransSegs: 10},
+			want:    tcpRates{},
+		},
+		{
+			name:    "no time elapsed",
+			current: tcpCounters{at: start, listenOverflows: 100, listenDrops: 200, outSegs: 2000, retransSegs: 500},
+			want:    tcpRates{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.current.ratesSince(previous); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.cern.ch/eos/argeos/internal/logger"
+	"gitlab.cern.ch/eos/argeos/internal/procfs"
+)
+
+// SysClassNet is where the network interfaces show up in sysfs
+var SysClassNet = "/sys/class/net"
+
+// Interface is the state and counters of a network interface. Speed is in
+// Mb/s, -1 when the link is down or the driver does not report it.
+type Interface struct {
+	Name      string            `json:"name"`
+	OperState string            `json:"operstate"`
+	Carrier   bool              `json:"carrier"`
+	MTU       int               `json:"mtu"`
+	Speed     int               `json:"speed"`
+	Address   string            `json:"address"`
+	Stats     map[string]uint64 `json:"stats"`
+}
+
+// targetSockets counts the sockets held by a target process
+type targetSockets struct {
+	Target string         `json:"target"`
+	Pid    int            `json:"pid"`
+	TCP    map[string]int `json:"tcp"`
+	Other  int            `json:"other"`
+}
+
+type dumpSummary struct {
+	Time       time.Time         `json:"time"`
+	Files      map[string]string `json:"files"` // "ok" or why the file is incomplete
+	Interfaces []Interface       `json:"interfaces"`
+	Sockets    SocketStats       `json:"sockets"`
+	Targets    []targetSockets   `json:"targets"`
+}
+
+func readSysfs(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func readInterfaces() ([]Interface, error) {
+	entries, err := os.ReadDir(SysClassNet)
+	if err != nil {
+		return nil, err
+	}
+	interfaces := make([]Interface, 0, len(entries))
+	for _, entry := range entries {
+		dir := filepath.Join(SysClassNet, entry.Name())
+		iface := Interface{
+			Name:      entry.Name(),
+			OperState: readSysfs(filepath.Join(dir, "operstate")),
+			Carrier:   readSysfs(filepath.Join(dir, "carrier")) == "1",
+			Address:   readSysfs(filepath.Join(dir, "address")),
+			Speed:     -1,
+			Stats:     make(map[string]uint64),
+		}
+		iface.MTU, _ = strconv.Atoi(readSysfs(filepath.Join(dir, "mtu")))
+		if speed, err := strconv.Atoi(readSysfs(filepath.Join(dir, "speed"))); err == nil {
+			iface.Speed = speed
+		}
+		counters, _ := os.ReadDir(filepath.Join(dir, "statistics"))
+		for _, counter := range counters {
+			value, err := strconv.ParseUint(readSysfs(filepath.Join(dir, "statistics", counter.Name())), 10, 64)
+			if err == nil {
+				iface.Stats[counter.Name()] = value
+			}
+		}
+		interfaces = append(interfaces, iface)
+	}
+	return interfaces, nil
+}
+
+// socketInodes returns the inodes of the sockets a process has open
+func socketInodes(pid int) ([]uint64, error) {
+	fds, err := procfs.Fds(pid)
+	if err != nil {
+		return nil, err
+	}
+	inodes := make([]uint64, 0)
+	for _, fd := range fds {
+		inode, found := strings.CutPrefix(fd.Target, "socket:[")
+		if !found {
+			continue
+		}
+		if value, err := strconv.ParseUint(strings.TrimSuffix(inode, "]"), 10, 64); err == nil {
+			inodes = append(inodes, value)
+		}
+	}
+	return inodes, nil
+}
+
+// dumpFile writes a dump file, with the error appended when it could not be
+// fully collected, and records the outcome in the summary
+func (summary *dumpSummary) dumpFile(dir string, name string, data []byte, err error) {
+	summary.Files[name] = "ok"
+	if err != nil {
+		summary.Files[name] = err.Error()
+		data = append(data, []byte(fmt.Sprintf("error: %s\n", err))...)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+		summary.Files[name] = err.Error()
+		logger.Logger.Error("Error writing network dump file", "file", name, "error", err)
+	}
+}
+
+func command(name string, args ...string) ([]byte, error) {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	return out, err
+}
+
+// dumpTargetSockets writes the TCP sockets of each target process
+func (np *NetworkPlugin) dumpTargetSockets(dir string, summary *dumpSummary, sockets []Socket) {
+	byInode := make(map[uint64]Socket, len(sockets))
+	for _, s := range sockets {
+		byInode[s.Inode] = s
+	}
+	for _, target := range np.config.Targets {
+		pids, err := target.Resolve()
+		if err != nil {
+			summary.Files["sockets_"+target.Name] = err.Error()
+			continue
+		}
+		for _, pid := range pids {
+			name := fmt.Sprintf("sockets_%s-%d.txt", target.Name, pid)
+			inodes, err := socketInodes(pid)
+			counts := targetSockets{Target: target.Name, Pid: pid, TCP: make(map[string]int)}
+			var out strings.Builder
+			fmt.Fprintf(&out, "%-12s %8s %8s %s %s\n", "State", "Recv-Q", "Send-Q", "Local", "Peer")
+			for _, inode := range inodes {
+				s, ok := byInode[inode]
+				if !ok {
+					counts.Other++
+					continue
+				}
+				counts.TCP[s.State]++
+				out.WriteString(s.String())
+				out.WriteByte('\n')
+			}
+			fmt.Fprintf(&out, "%d other sockets\n", counts.Other)
+			summary.dumpFile(dir, name, []byte(out.String()), err)
+			summary.Targets = append(summary.Targets, counts)
+		}
+	}
+}
+
+func (np *NetworkPlugin) diagnosticDump(dumpDir string) (string, error) {
+	networkDir := filepath.Join(dumpDir, "network")
+	if err := os.MkdirAll(networkDir, 0755); err != nil {
+		return "", err
+	}
+	summary := dumpSummary{Time: time.Now(), Files: make(map[string]string)}
+
+	out, err := np.run_ss("")
+	summary.dumpFile(networkDir, "ss.txt", out, err)
+	out, err = np.run_ss("-tinpm")
+	summary.dumpFile(networkDir, "ss_info.txt", out, err)
+
+	for _, family := range []string{"-4", "-6"} {
+		out, err := command("ip", family, "route", "show", "table", "all")
+		summary.dumpFile(networkDir, "routes"+strings.TrimPrefix(family, "-")+".txt", out, err)
+	}
+	out, err = command("ip", "-d", "-s", "addr", "show")
+	summary.dumpFile(networkDir, "addresses.txt", out, err)
+
+	for _, name := range []string{"snmp", "snmp6", "netstat", "sockstat", "sockstat6", "route", "ipv6_route"} {
+		out, err := os.ReadFile(filepath.Join(procfs.Root, "net", name))
+		summary.dumpFile(networkDir, name, out, err)
+	}
+
+	summary.Interfaces, err = readInterfaces()
+	if err != nil {
+		summary.Files["interfaces"] = err.Error()
+	}
+	sort.Slice(summary.Interfaces, func(i, j int) bool { return summary.Interfaces[i].Name < summary.Interfaces[j].Name })
+
+	summary.Sockets, err = collectSocketStats(np.watchedPorts())
+	if err != nil {
+		summary.Files["sockets"] = err.Error()
+	}
+	sockets, err := ReadSockets()
+	if err != nil {
+		summary.Files["sockets"] = err.Error()
+	}
+	np.dumpTargetSockets(networkDir, &summary, sockets)
+
+	summaryJSON, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(networkDir, "summary.json"), summaryJSON, 0644); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("network: dumped %d files", len(summary.Files)+1), nil
+}
@@ -0,0 +1,129 @@
+package network
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.cern.ch/eos/argeos/internal/common"
+)
+
+const (
+	EndpointTCP = "tcp" // connect to Address, host:port
+	EndpointTLS = "tls" // connect and complete a TLS handshake with Address
+	EndpointDNS = "dns" // resolve Address, a host name
+)
+
+// EndpointConfig Timeout is in seconds, latency thresholds in milliseconds.
+// State is reported when the endpoint cannot be reached, FAIL by default.
+type EndpointConfig struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Address     string `json:"address"`
+	Timeout     int32  `json:"timeout"`
+	LatencyWarn int32  `json:"latency_warn_ms"`
+	LatencyFail int32  `json:"latency_fail_ms"`
+	ServerName  string `json:"server_name"`
+	Insecure    bool   `json:"insecure"`
+	State       string `json:"state"`
+
+	state common.HealthState
+}
+
+const DefaultEndpointTimeout = 5
+
+func (ep *EndpointConfig) setDefaults() error {
+	if ep.Type == "" {
+		ep.Type = EndpointTCP
+	}
+	switch ep.Type {
+	case EndpointTCP, EndpointTLS:
+		if _, _, err := net.SplitHostPort(ep.Address); err != nil {
+			return err
+		}
+	case EndpointDNS:
+	default:
+		return fmt.Errorf("unknown endpoint type %q", ep.Type)
+	}
+	if ep.Name == "" {
+		ep.Name = ep.Address
+	}
+	if ep.Timeout <= 0 {
+		ep.Timeout = DefaultEndpointTimeout
+	}
+	ep.state = common.StateFAIL
+	if ep.State != "" {
+		state, ok := common.HealthStateFromString(strings.ToUpper(ep.State))
+		if !ok {
+			return fmt.Errorf("invalid state %q", ep.State)
+		}
+		ep.state = state
+	}
+	return nil
+}
+
+// probe reaches the endpoint, returning how long it took
+func (ep EndpointConfig) probe(ctx context.Context) (time.Duration, error) {
+	start := time.Now()
+	switch ep.Type {
+	case EndpointDNS:
+		addrs, err := net.DefaultResolver.LookupHost(ctx, ep.Address)
+		if err == nil && len(addrs) == 0 {
+			err = fmt.Errorf("no addresses")
+		}
+		return time.Since(start), err
+	case EndpointTLS:
+		dialer := &tls.Dialer{Config: &tls.Config{ServerName: ep.ServerName, InsecureSkipVerify: ep.Insecure}}
+		conn, err := dialer.DialContext(ctx, "tcp", ep.Address)
+		if err != nil {
+			return 0, err
+		}
+		conn.Close()
+		return time.Since(start), nil
+	default:
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", ep.Address)
+		if err != nil {
+			return 0, err
+		}
+		conn.Close()
+		return time.Since(start), nil
+	}
+}
+
+func (ep EndpointConfig) check() common.HealthStatus {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(ep.Timeout)*time.Second)
+	defer cancel()
+	latency, err := ep.probe(ctx)
+	if err != nil {
+		return common.HealthStatus{
+			State:       ep.state,
+			StateString: common.HealthStateString(ep.state),
+			Name:        ep.Name,
+			Detail:      fmt.Sprintf("%s %s %s: %s", ep.Name, ep.Type, ep.Address, err),
+		}
+	}
+	ms := float64(latency) / float64(time.Millisecond)
+	detail := fmt.Sprintf("%s %s %s: %.1fms", ep.Name, ep.Type, ep.Address, ms)
+	return thresholdHealth(detail, ms, float64(ep.LatencyWarn), float64(ep.LatencyFail)).WithComponent(ep.Name)
+}
+
+// checkEndpoints checks all endpoints concurrently, so the slowest one bounds
+// the time taken
+func checkEndpoints(endpoints []EndpointConfig) []common.HealthStatus {
+	statuses := make([]common.HealthStatus, len(endpoints))
+	var wg sync.WaitGroup
+	for i, ep := range endpoints {
+		wg.Add(1)
+		go func(i int, ep EndpointConfig) {
+			defer wg.Done()
+			statuses[i] = ep.check()
+		}(i, ep)
+	}
+	wg.Wait()
+	return statuses
+}
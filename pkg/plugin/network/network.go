@@ -2,31 +2,152 @@ package network
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
-	"os"
 	"os/exec"
+	"strings"
+	"sync"
+	"time"
 
 	"gitlab.cern.ch/eos/argeos/config"
 	"gitlab.cern.ch/eos/argeos/internal/common"
 	"gitlab.cern.ch/eos/argeos/internal/logger"
+	"gitlab.cern.ch/eos/argeos/internal/procfs"
 	"gitlab.cern.ch/eos/argeos/pkg/plugin"
 )
 
+// PortConfig thresholds are numbers of connections waiting to be accepted on
+// the port and connections in CLOSE-WAIT, zero disables the listen queue ones
+type PortConfig struct {
+	Port            int `json:"port"`
+	ListenQueueWarn int `json:"listen_queue_warn"`
+	ListenQueueFail int `json:"listen_queue_fail"`
+	CloseWaitWarn   int `json:"close_wait_warn"`
+	CloseWaitFail   int `json:"close_wait_fail"`
+}
+
+// PluginConfig socket memory thresholds are percentages of the tcp_mem
+// maximum, the default warning matches the kernel default pressure level.
+// Listen overflows and SYN drops are per minute, retransmissions a percentage
+// of the segments sent, only checked once RetransMinSegments were sent since
+// the previous check. CheckInterval is in seconds. Targets, whose sockets are
+// dumped, default to the ones of the process plugin.
+type PluginConfig struct {
+	Ports              []PortConfig     `json:"ports"`
+	Endpoints          []EndpointConfig `json:"endpoints"`
+	Targets            []procfs.Target  `json:"targets"`
+	SocketMemWarn      float64          `json:"socket_mem_warn"`
+	SocketMemFail      float64          `json:"socket_mem_fail"`
+	ListenOverflowWarn float64          `json:"listen_overflow_warn"`
+	ListenOverflowFail float64          `json:"listen_overflow_fail"`
+	SynDropWarn        float64          `json:"syn_drop_warn"`
+	SynDropFail        float64          `json:"syn_drop_fail"`
+	RetransWarn        float64          `json:"retrans_warn"`
+	RetransFail        float64          `json:"retrans_fail"`
+	RetransMinSegments int64            `json:"retrans_min_segments"`
+	CheckInterval      int32            `json:"check_interval"`
+}
+
+const (
+	DefaultSocketMemWarn      = 66
+	DefaultSocketMemFail      = 90
+	DefaultCloseWaitWarn      = 100
+	DefaultCloseWaitFail      = 500
+	DefaultListenOverflowWarn = 1
+	DefaultListenOverflowFail = 100
+	DefaultSynDropWarn        = 1
+	DefaultSynDropFail        = 100
+	DefaultRetransWarn        = 5
+	DefaultRetransFail        = 20
+	DefaultRetransMinSegments = 1000
+	DefaultCheckInterval      = 30
+)
+
 type NetworkPlugin struct {
 	name        string
-	commandHelp map[string]string
-	cfg         config.Config
+	commandHelp map[string]plugin.Command
+	config      PluginConfig
+
+	mu             sync.Mutex // guards counters and counterHealths
+	counters       tcpCounters
+	counterHealths []common.HealthStatus
 }
 
-func NewPlugin(config config.Config) plugin.Plugin {
+func NewPlugin(cfg config.Config) plugin.Plugin {
+	var pluginConfig PluginConfig
+	if err := plugin.DecodeConfig(cfg, "network", &pluginConfig); err != nil {
+		logger.Logger.Error("Error decoding network plugin config", "error", err)
+	}
+	if len(pluginConfig.Targets) == 0 {
+		var processConfig struct {
+			Targets []procfs.Target `json:"targets"`
+		}
+		plugin.DecodeConfig(cfg, "process", &processConfig)
+		pluginConfig.Targets = processConfig.Targets
+	}
+	if pluginConfig.SocketMemWarn <= 0 {
+		pluginConfig.SocketMemWarn = DefaultSocketMemWarn
+	}
+	if pluginConfig.SocketMemFail <= 0 {
+		pluginConfig.SocketMemFail = DefaultSocketMemFail
+	}
+	for i := range pluginConfig.Ports {
+		if pluginConfig.Ports[i].CloseWaitWarn <= 0 {
+			pluginConfig.Ports[i].CloseWaitWarn = DefaultCloseWaitWarn
+		}
+		if pluginConfig.Ports[i].CloseWaitFail <= 0 {
+			pluginConfig.Ports[i].CloseWaitFail = DefaultCloseWaitFail
+		}
+	}
+	endpoints := make([]EndpointConfig, 0, len(pluginConfig.Endpoints))
+	for _, ep := range pluginConfig.Endpoints {
+		if err := ep.setDefaults(); err != nil {
+			logger.Logger.Error("Invalid network endpoint, skipping", "endpoint", ep.Name, "address", ep.Address, "error", err)
+			continue
+		}
+		endpoints = append(endpoints, ep)
+	}
+	pluginConfig.Endpoints = endpoints
+	if pluginConfig.ListenOverflowWarn <= 0 {
+		pluginConfig.ListenOverflowWarn = DefaultListenOverflowWarn
+	}
+	if pluginConfig.ListenOverflowFail <= 0 {
+		pluginConfig.ListenOverflowFail = DefaultListenOverflowFail
+	}
+	if pluginConfig.SynDropWarn <= 0 {
+		pluginConfig.SynDropWarn = DefaultSynDropWarn
+	}
+	if pluginConfig.SynDropFail <= 0 {
+		pluginConfig.SynDropFail = DefaultSynDropFail
+	}
+	if pluginConfig.RetransWarn <= 0 {
+		pluginConfig.RetransWarn = DefaultRetransWarn
+	}
+	if pluginConfig.RetransFail <= 0 {
+		pluginConfig.RetransFail = DefaultRetransFail
+	}
+	if pluginConfig.RetransMinSegments <= 0 {
+		pluginConfig.RetransMinSegments = DefaultRetransMinSegments
+	}
+	if pluginConfig.CheckInterval <= 0 {
+		pluginConfig.CheckInterval = DefaultCheckInterval
+	}
+
 	return &NetworkPlugin{
 		name: "network",
-		commandHelp: map[string]string{
-			"check_network":   "Check Network Status",
-			"diagnostic_dump": "Dump network status to a directory",
+		commandHelp: map[string]plugin.Command{
+			"check_network": {Description: "Check Network Status"},
+			"check_endpoints": {Description: "Check that the configured endpoints can be reached", Args: []plugin.Arg{
+				{Name: "endpoint", Type: plugin.ArgString, Description: "Only check the endpoint with this name"},
+			}},
+			"socket_stats": {Description: "Show TCP socket states, queues and memory per listening port", Args: []plugin.Arg{
+				{Name: "format", Type: plugin.ArgString, Description: "--json for JSON output, text otherwise"},
+			}},
+			"diagnostic_dump": {Description: "Dump interfaces, routes, socket info and counters to a directory", Args: []plugin.Arg{plugin.DumpDirArg}},
 		},
-		cfg: config,
+		config: pluginConfig,
 	}
 }
 
@@ -69,17 +190,150 @@ func (np *NetworkPlugin) run_ss(args string) ([]byte, error) {
 
 }
 
+func (np *NetworkPlugin) watchedPorts() []int {
+	ports := make([]int, 0, len(np.config.Ports))
+	for _, port := range np.config.Ports {
+		ports = append(ports, port.Port)
+	}
+	return ports
+}
+
+func thresholdHealth(detail string, value float64, warn float64, fail float64) common.HealthStatus {
+	switch {
+	case fail > 0 && value >= fail:
+		return common.HealthFAIL(detail)
+	case warn > 0 && value >= warn:
+		return common.HealthWARN(detail)
+	default:
+		return common.HealthOK(detail)
+	}
+}
+
+// socketHealth checks the listen queues and CLOSE-WAIT connections of the
+// watched ports and the TCP memory usage
+func (np *NetworkPlugin) socketHealth(stats SocketStats) []common.HealthStatus {
+	statuses := make([]common.HealthStatus, 0, 2*len(np.config.Ports)+1)
+	for _, port := range np.config.Ports {
+		ps := stats.Port(port.Port)
+		// a process that stopped reading its sockets often also stopped
+		// listening, report the CLOSE-WAIT pileup in any case
+		closeWait := ps.States[stateCloseWait]
+		statuses = append(statuses, thresholdHealth(fmt.Sprintf("port %d: %d connections in CLOSE-WAIT", port.Port, closeWait),
+			float64(closeWait), float64(port.CloseWaitWarn), float64(port.CloseWaitFail)))
+		if ps.States[stateListen] == 0 {
+			statuses = append(statuses, common.HealthWARN(fmt.Sprintf("port %d: nothing listening", port.Port)))
+			continue
+		}
+		statuses = append(statuses, thresholdHealth(fmt.Sprintf("port %d: %d connections waiting to be accepted", port.Port, ps.ListenQueue),
+			float64(ps.ListenQueue), float64(port.ListenQueueWarn), float64(port.ListenQueueFail)))
+	}
+
+	if stats.Memory.Max > 0 {
+		used := float64(stats.Memory.Mem) * 100 / float64(stats.Memory.Max)
+		statuses = append(statuses, thresholdHealth(fmt.Sprintf("tcp memory %.1f%% of tcp_mem max", used),
+			used, np.config.SocketMemWarn, np.config.SocketMemFail))
+	}
+	return statuses
+}
+
+// sampleCounters checks the rates of the kernel TCP counters since the
+// previous sample, the first sample only takes the baseline. Only the
+// monitor loop samples, every check_interval, so that the rates are not
+// computed over the short windows between overlapping healthchecks.
+func (np *NetworkPlugin) sampleCounters() {
+	statuses := np.counterRates()
+	np.mu.Lock()
+	np.counterHealths = statuses
+	np.mu.Unlock()
+}
+
+func (np *NetworkPlugin) counterRates() []common.HealthStatus {
+	current, err := sampleTCPCounters()
+	if err != nil {
+		return []common.HealthStatus{common.HealthERROR(fmt.Sprintf("tcp counters: %s", err))}
+	}
+	np.mu.Lock()
+	previous := np.counters
+	np.counters = current
+	np.mu.Unlock()
+	if previous.at.IsZero() {
+		return nil
+	}
+
+	rates := current.ratesSince(previous)
+	statuses := []common.HealthStatus{
+		thresholdHealth(fmt.Sprintf("%.1f listen overflows/min", rates.listenOverflows),
+			rates.listenOverflows, np.config.ListenOverflowWarn, np.config.ListenOverflowFail),
+		thresholdHealth(fmt.Sprintf("%.1f SYN drops/min", rates.synDrops),
+			rates.synDrops, np.config.SynDropWarn, np.config.SynDropFail),
+	}
+	if rates.outSegs >= np.config.RetransMinSegments {
+		statuses = append(statuses, thresholdHealth(fmt.Sprintf("%.2f%% of %d segments retransmitted", rates.retransPercent, rates.outSegs),
+			rates.retransPercent, np.config.RetransWarn, np.config.RetransFail))
+	}
+	return statuses
+}
+
+// counterHealth returns the statuses of the last counter sample
+func (np *NetworkPlugin) counterHealth() []common.HealthStatus {
+	np.mu.Lock()
+	defer np.mu.Unlock()
+	return append([]common.HealthStatus(nil), np.counterHealths...)
+}
+
 func (np *NetworkPlugin) HealthCheck() common.HealthStatus {
 	logger.Logger.Debug("Running Network plugin")
 
-	_, err := np.run_ss("")
+	stats, err := collectSocketStats(np.watchedPorts())
 	if err != nil {
 		return common.HealthERROR(err.Error())
 	}
-	return common.HealthOK("OK")
+
+	worst := common.HealthOK("")
+	details := []string{fmt.Sprintf("%d tcp sockets, %d listening", stats.Memory.InUse, stats.States[stateListen])}
+	statuses := append(np.socketHealth(stats), np.counterHealth()...)
+	statuses = append(statuses, checkEndpoints(np.config.Endpoints)...)
+	for _, status := range statuses {
+		if common.WorseState(worst.State, status.State) != worst.State {
+			worst = status
+		}
+		if status.State != common.StateOK {
+			details = append(details, status.Detail)
+		}
+	}
+	worst.Detail = strings.Join(details, "; ")
+	return worst.WithComponent(np.name)
+}
+
+func (np *NetworkPlugin) Start(ctx context.Context, updateChannel chan<- common.HealthStatus) error {
+	interval := time.Duration(np.config.CheckInterval) * time.Second
+	logger.Logger.Info("Starting network monitor", "ports", len(np.config.Ports), "interval", interval)
+	np.sampleCounters()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	previous := common.StateOK
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Logger.Info("Network monitor stopped")
+			return nil
+		case <-ticker.C:
+			np.sampleCounters()
+			status := np.HealthCheck()
+			if status.State != previous {
+				updateChannel <- status
+			}
+			previous = status.State
+		}
+	}
+}
+
+func (np *NetworkPlugin) Stop() {
+	logger.Logger.Info("Stopping network monitor")
 }
 
-func (np *NetworkPlugin) CommandHelp() map[string]string {
+func (np *NetworkPlugin) CommandHelp() map[string]plugin.Command {
 	return np.commandHelp
 }
 
@@ -91,26 +345,39 @@ func (np *NetworkPlugin) Execute(command string, args ...string) (string, error)
 			return "", err
 		}
 		return string(output), nil
-	case "diagnostic_dump":
-		if len(args) < 1 {
-			return "", fmt.Errorf("no diagnostic directory provided")
+	case "check_endpoints":
+		endpoints := np.config.Endpoints
+		if len(args) > 0 {
+			endpoints = nil
+			for _, ep := range np.config.Endpoints {
+				if ep.Name == args[0] {
+					endpoints = append(endpoints, ep)
+				}
+			}
+			if len(endpoints) == 0 {
+				return "", fmt.Errorf("unknown endpoint %s", args[0])
+			}
 		}
-		network_dir := fmt.Sprintf("%s/network", args[0])
-		err := os.MkdirAll(network_dir, 0755)
-		if err != nil {
-			return "", err
+		lines := make([]string, 0, len(endpoints))
+		for _, status := range checkEndpoints(endpoints) {
+			lines = append(lines, fmt.Sprintf("%s %s", status.StateString, status.Detail))
 		}
-
-		output, err := np.run_ss("")
+		return strings.Join(lines, "\n"), nil
+	case "socket_stats":
+		stats, err := collectSocketStats(np.watchedPorts())
 		if err != nil {
 			return "", err
 		}
-
-		err = os.WriteFile(fmt.Sprintf("%s/ss.txt", network_dir), output, 0644)
-		if err != nil {
-			return "", err
+		if len(args) > 0 && args[0] == "--json" {
+			out, err := json.MarshalIndent(stats, "", "  ")
+			return string(out), err
+		}
+		return stats.String(), nil
+	case "diagnostic_dump":
+		if len(args) < 1 {
+			return "", fmt.Errorf("no diagnostic directory provided")
 		}
-		return "OK", nil
+		return np.diagnosticDump(args[0])
 	default:
 		return "", fmt.Errorf("command not implemented")
 	}
@@ -0,0 +1,279 @@
+package network
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gitlab.cern.ch/eos/argeos/internal/procfs"
+)
+
+// tcpStates maps the st column of /proc/net/tcp to the names ss uses
+var tcpStates = map[uint64]string{
+	0x01: "ESTAB",
+	0x02: "SYN-SENT",
+	0x03: "SYN-RECV",
+	0x04: "FIN-WAIT-1",
+	0x05: "FIN-WAIT-2",
+	0x06: "TIME-WAIT",
+	0x07: "CLOSE",
+	0x08: "CLOSE-WAIT",
+	0x09: "LAST-ACK",
+	0x0A: "LISTEN",
+	0x0B: "CLOSING",
+	0x0C: "NEW-SYN-RECV",
+}
+
+const (
+	stateListen    = "LISTEN"
+	stateCloseWait = "CLOSE-WAIT"
+)
+
+// Socket is one line of /proc/net/tcp or tcp6. For listening sockets
+// RxQueue is the number of connections waiting to be accepted.
+type Socket struct {
+	Local   net.IP `json:"local"`
+	LPort   int    `json:"local_port"`
+	Remote  net.IP `json:"remote"`
+	RPort   int    `json:"remote_port"`
+	State   string `json:"state"`
+	TxQueue uint64 `json:"tx_queue"`
+	RxQueue uint64 `json:"rx_queue"`
+	UID     int    `json:"uid"`
+	Inode   uint64 `json:"inode"`
+}
+
+func (s Socket) String() string {
+	return fmt.Sprintf("%-12s %8d %8d %s %s", s.State, s.RxQueue, s.TxQueue,
+		net.JoinHostPort(s.Local.String(), strconv.Itoa(s.LPort)),
+		net.JoinHostPort(s.Remote.String(), strconv.Itoa(s.RPort)))
+}
+
+// parseAddr decodes "0100007F:BC8F", the address being made of 32 bit words
+// in host (little endian) byte order
+func parseAddr(field string) (net.IP, int, error) {
+	addr, port, found := strings.Cut(field, ":")
+	if !found {
+		return nil, 0, fmt.Errorf("malformed address %q", field)
+	}
+	raw, err := hex.DecodeString(addr)
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return nil, 0, fmt.Errorf("malformed address %q", field)
+	}
+	ip := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		ip[i], ip[i+1], ip[i+2], ip[i+3] = raw[i+3], raw[i+2], raw[i+1], raw[i]
+	}
+	p, err := strconv.ParseUint(port, 16, 16)
+	if err != nil {
+		return nil, 0, fmt.Errorf("malformed port %q", field)
+	}
+	return ip, int(p), nil
+}
+
+func parseSocket(line string) (Socket, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 10 {
+		return Socket{}, fmt.Errorf("short socket line: %q", line)
+	}
+	var s Socket
+	var err error
+	if s.Local, s.LPort, err = parseAddr(fields[1]); err != nil {
+		return Socket{}, err
+	}
+	if s.Remote, s.RPort, err = parseAddr(fields[2]); err != nil {
+		return Socket{}, err
+	}
+	st, _ := strconv.ParseUint(fields[3], 16, 8)
+	s.State = tcpStates[st]
+	if s.State == "" {
+		s.State = fmt.Sprintf("UNKNOWN-%02X", st)
+	}
+	tx, rx, _ := strings.Cut(fields[4], ":")
+	s.TxQueue, _ = strconv.ParseUint(tx, 16, 64)
+	s.RxQueue, _ = strconv.ParseUint(rx, 16, 64)
+	s.UID, _ = strconv.Atoi(fields[7])
+	s.Inode, _ = strconv.ParseUint(fields[9], 10, 64)
+	return s, nil
+}
+
+// ReadSockets parses the IPv4 and IPv6 TCP socket tables. A missing tcp6
+// table, on hosts without IPv6, is not an error.
+func ReadSockets() ([]Socket, error) {
+	sockets := make([]Socket, 0)
+	for _, table := range []string{"tcp", "tcp6"} {
+		f, err := os.Open(filepath.Join(procfs.Root, "net", table))
+		if os.IsNotExist(err) && table == "tcp6" {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Scan() // header
+		for scanner.Scan() {
+			s, err := parseSocket(scanner.Text())
+			if err != nil {
+				continue
+			}
+			sockets = append(sockets, s)
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sockets, nil
+}
+
+// PortStats aggregates the sockets of a local port
+type PortStats struct {
+	Port        int            `json:"port"`
+	States      map[string]int `json:"states"`
+	ListenQueue uint64         `json:"listen_queue"`
+	TxQueue     uint64         `json:"tx_queue"`
+	RxQueue     uint64         `json:"rx_queue"`
+}
+
+// SocketMemory is the TCP line of /proc/net/sockstat and the tcp_mem limits,
+// all in pages
+type SocketMemory struct {
+	InUse    uint64 `json:"inuse"`
+	Orphan   uint64 `json:"orphan"`
+	TimeWait uint64 `json:"tw"`
+	Alloc    uint64 `json:"alloc"`
+	Mem      uint64 `json:"mem"`
+	Pressure uint64 `json:"pressure"`
+	Max      uint64 `json:"max"`
+}
+
+// SocketStats only breaks down the ports with a listening socket, plus the
+// watched ones, to leave out the ephemeral ports of outgoing connections
+type SocketStats struct {
+	States map[string]int `json:"states"`
+	Ports  []*PortStats   `json:"ports"`
+	Memory SocketMemory   `json:"memory"`
+}
+
+func (ss SocketStats) Port(port int) *PortStats {
+	for _, ps := range ss.Ports {
+		if ps.Port == port {
+			return ps
+		}
+	}
+	return nil
+}
+
+func readSocketMemory() (SocketMemory, error) {
+	var mem SocketMemory
+	data, err := os.ReadFile(filepath.Join(procfs.Root, "net", "sockstat"))
+	if err != nil {
+		return mem, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != "TCP:" {
+			continue
+		}
+		for i := 1; i+1 < len(fields); i += 2 {
+			value, _ := strconv.ParseUint(fields[i+1], 10, 64)
+			switch fields[i] {
+			case "inuse":
+				mem.InUse = value
+			case "orphan":
+				mem.Orphan = value
+			case "tw":
+				mem.TimeWait = value
+			case "alloc":
+				mem.Alloc = value
+			case "mem":
+				mem.Mem = value
+			}
+		}
+	}
+
+	data, err = os.ReadFile(filepath.Join(procfs.Root, "sys", "net", "ipv4", "tcp_mem"))
+	if err != nil {
+		return mem, err
+	}
+	limits := strings.Fields(string(data))
+	if len(limits) == 3 {
+		mem.Pressure, _ = strconv.ParseUint(limits[1], 10, 64)
+		mem.Max, _ = strconv.ParseUint(limits[2], 10, 64)
+	}
+	return mem, nil
+}
+
+// collectSocketStats aggregates the sockets per local port, always including
+// the watched ports
+func collectSocketStats(watched []int) (SocketStats, error) {
+	sockets, err := ReadSockets()
+	if err != nil {
+		return SocketStats{}, err
+	}
+	stats := SocketStats{States: make(map[string]int)}
+	ports := make(map[int]*PortStats)
+	for _, port := range watched {
+		ports[port] = &PortStats{Port: port, States: make(map[string]int)}
+	}
+	for _, s := range sockets {
+		if s.State == stateListen && ports[s.LPort] == nil {
+			ports[s.LPort] = &PortStats{Port: s.LPort, States: make(map[string]int)}
+		}
+	}
+	for _, s := range sockets {
+		stats.States[s.State]++
+		ps := ports[s.LPort]
+		if ps == nil {
+			continue
+		}
+		ps.States[s.State]++
+		if s.State == stateListen {
+			ps.ListenQueue += s.RxQueue
+			continue
+		}
+		ps.TxQueue += s.TxQueue
+		ps.RxQueue += s.RxQueue
+	}
+	for _, ps := range ports {
+		stats.Ports = append(stats.Ports, ps)
+	}
+	sort.Slice(stats.Ports, func(i, j int) bool { return stats.Ports[i].Port < stats.Ports[j].Port })
+
+	stats.Memory, err = readSocketMemory()
+	return stats, err
+}
+
+func (ss SocketStats) String() string {
+	var out strings.Builder
+	states := make([]string, 0, len(ss.States))
+	for state := range ss.States {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+	for _, state := range states {
+		fmt.Fprintf(&out, "%s=%d ", state, ss.States[state])
+	}
+	fmt.Fprintf(&out, "\ntcp memory: %d pages (pressure %d, max %d), %d orphans\n",
+		ss.Memory.Mem, ss.Memory.Pressure, ss.Memory.Max, ss.Memory.Orphan)
+	for _, ps := range ss.Ports {
+		fmt.Fprintf(&out, "port %d: listen_queue=%d rx_queue=%d tx_queue=%d", ps.Port, ps.ListenQueue, ps.RxQueue, ps.TxQueue)
+		states := make([]string, 0, len(ps.States))
+		for state := range ps.States {
+			states = append(states, state)
+		}
+		sort.Strings(states)
+		for _, state := range states {
+			fmt.Fprintf(&out, " %s=%d", state, ps.States[state])
+		}
+		out.WriteByte('\n')
+	}
+	return out.String()
+}
@@ -0,0 +1,89 @@
+package network
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestParseAddr(t *testing.T) {
+	tests := []struct {
+		field   string
+		ip      string
+		port    int
+		wantErr bool
+	}{
+		{"0100007F:0050", "127.0.0.1", 80, false},
+		{"00000000:0438", "0.0.0.0", 1080, false},
+		{"0A00010A:BC8F", "10.1.0.10", 48271, false},
+		{"00000000000000000000000001000000:0016", "::1", 22, false},
+		{"B80D0120000000000000000001000000:0438", "2001:db8::1", 1080, false},
+		{"0100007F", "", 0, true},
+		{"0100007G:0050", "", 0, true},
+		{"01007F:0050", "", 0, true},
+		{"0100007F:XYZ", "", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			ip, port, err := parseAddr(tt.field)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !ip.Equal(net.ParseIP(tt.ip)) || port != tt.port {
+				t.Errorf("got %s:%d, want %s:%d", ip, port, tt.ip, tt.port)
+			}
+		})
+	}
+}
+
+func TestParseSocket(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    Socket
+		wantErr bool
+	}{
+		{
+			name: "listen",
+			line: "   0: 00000000:0438 00000000:0000 0A 00000000:00000005 00:00000000 00000000     0        0 26345 1 0000000000000000 100 0 0 10 0",
+			want: Socket{Local: net.ParseIP("0.0.0.0"), LPort: 1080, Remote: net.ParseIP("0.0.0.0"),
+				State: "LISTEN", RxQueue: 5, UID: 0, Inode: 26345},
+		},
+		{
+			name: "close wait",
+			line: "  12: 0A00010A:0438 0B00010A:D2F0 08 0000002A:00000000 00:00000000 00000000  1000        0 81234 1 0000000000000000 20 4 30 10 -1",
+			want: Socket{Local: net.ParseIP("10.1.0.10"), LPort: 1080, Remote: net.ParseIP("10.1.0.11"), RPort: 54000,
+				State: "CLOSE-WAIT", TxQueue: 42, UID: 1000, Inode: 81234},
+		},
+		{
+			name: "unknown state",
+			line: "   1: 0100007F:0050 0100007F:D2F0 1F 00000000:00000000 00:00000000 00000000     0        0 1 1",
+			want: Socket{Local: net.ParseIP("127.0.0.1"), LPort: 80, Remote: net.ParseIP("127.0.0.1"), RPort: 54000,
+				State: "UNKNOWN-1F", Inode: 1},
+		},
+		{name: "short", line: "   0: 00000000:0438 00000000:0000 0A", wantErr: true},
+		{name: "bad address", line: "   0: zz:0438 00000000:0000 0A 0:0 00:0 0 0 0 1 1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSocket(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !got.Local.Equal(tt.want.Local) || !got.Remote.Equal(tt.want.Remote) {
+				t.Errorf("got %s -> %s, want %s -> %s", got.Local, got.Remote, tt.want.Local, tt.want.Remote)
+			}
+			// net.ParseIP returns 16 byte addresses, compared above already
+			got.Local, got.Remote = tt.want.Local, tt.want.Remote
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
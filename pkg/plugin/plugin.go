@@ -1,11 +1,15 @@
 package plugin
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
+	"gitlab.cern.ch/eos/argeos/config"
 	"gitlab.cern.ch/eos/argeos/internal/common"
 	"gitlab.cern.ch/eos/argeos/internal/logger"
 )
@@ -13,24 +17,71 @@ import (
 type Plugin interface {
 	Name() string // Name of the plugin
 	HealthCheck() common.HealthStatus
-	CommandHelp() map[string]string
+	CommandHelp() map[string]Command
 	Execute(command string, args ...string) (string, error)
 }
 
-func SupportedCommands(p Plugin) []string {
-	commands := make([]string, 0, len(p.CommandHelp()))
-	for command := range p.CommandHelp() {
+// ComponentChecker is implemented by plugins made of independently checked
+// components, like the bash health scripts. The healthcheck reports each of
+// them as its own entry, named <plugin>/<component>.
+type ComponentChecker interface {
+	ComponentHealth() []common.HealthStatus
+}
+
+// CommandHelp returns the commands of the plugin through SafeCall, nil when
+// it panicked or is quarantined, so that it is skipped.
+func (pm *PluginManager) CommandHelp(p Plugin) map[string]Command {
+	help, _ := pm.commandHelp(p)
+	return help
+}
+
+func (pm *PluginManager) commandHelp(p Plugin) (map[string]Command, error) {
+	var help map[string]Command
+	if err := pm.SafeCall(pm.PluginName(p), "command_help", func() {
+		help = p.CommandHelp()
+	}); err != nil {
+		return nil, err
+	}
+	return help, nil
+}
+
+func (pm *PluginManager) SupportedCommands(p Plugin) []string {
+	help := pm.CommandHelp(p)
+	commands := make([]string, 0, len(help))
+	for command := range help {
 		commands = append(commands, command)
 	}
+	sort.Strings(commands)
 	return commands
 }
 
+func (pm *PluginManager) SupportsCommand(p Plugin, command string) bool {
+	_, ok := pm.CommandHelp(p)[command]
+	return ok
+}
+
 type PluginManager struct {
-	Plugins []Plugin
+	Plugins         []Plugin
+	dumpConcurrency int
+	dumpTimeout     time.Duration
+	// dumpSlots holds a slot for each plugin dump still running, including
+	// the ones past their deadline, so that dumpConcurrency is a real bound
+	dumpSlots chan struct{}
+
+	panicMu         sync.Mutex // guards panicCount and panics
+	panicQuarantine int
+	panicCount      map[string]int
+	panics          []panicRecord // not yet written to a dump
 }
 
-func NewManager() *PluginManager {
-	return &PluginManager{}
+func NewManager(cfg config.ServerConfig) *PluginManager {
+	return &PluginManager{
+		dumpConcurrency: max(cfg.DumpConcurrency, 1),
+		dumpTimeout:     time.Duration(cfg.DumpTimeout) * time.Second,
+		dumpSlots:       make(chan struct{}, max(cfg.DumpConcurrency, 1)),
+		panicQuarantine: max(cfg.PanicQuarantine, 1),
+		panicCount:      make(map[string]int),
+	}
 }
 
 func (pm *PluginManager) Register(plugin Plugin) {
@@ -43,17 +94,31 @@ func (pm *PluginManager) ExecuteCommand(command string, args ...string) string {
 
 	for _, plugin := range pm.Plugins {
 
-		for _, cmd := range SupportedCommands(plugin) {
-			if cmd == command {
-				plugin_result, err := plugin.Execute(command, args...)
-				if err != nil {
-					logger.Logger.Error("Error executing command", "plugin", plugin.Name(), "command", command, "error", err)
-					continue
-				}
-				result += plugin_result
-				result += "\n"
-			}
+		schema, ok := pm.CommandHelp(plugin)[command]
+		if !ok {
+			continue
+		}
+		name := pm.PluginName(plugin)
+		validated, err := schema.Validate(args)
+		if err != nil {
+			logger.Logger.Warn("Invalid arguments for command", "plugin", name, "command", command, "error", err)
+			result += fmt.Sprintf("%s: invalid arguments for %s: %s, usage: %s %s\n", name, command, err, command, schema.Usage())
+			continue
 		}
+		var plugin_result string
+		var exec_err error
+		err = pm.SafeCall(name, command, func() {
+			plugin_result, exec_err = plugin.Execute(command, validated...)
+		})
+		if err == nil {
+			err = exec_err
+		}
+		if err != nil {
+			logger.Logger.Error("Error executing command", "plugin", name, "command", command, "error", err)
+			continue
+		}
+		result += plugin_result
+		result += "\n"
 	}
 	if result == "" {
 		return fmt.Sprintf("Command %s not supported", command)
@@ -61,16 +126,23 @@ func (pm *PluginManager) ExecuteCommand(command string, args ...string) string {
 	return result
 }
 
-func (pm *PluginManager) SupportedCommands() string {
-	commands := make([]string, 0)
+// Commands lists the commands of all plugins, in plugin registration order
+// and sorted by name within a plugin.
+func (pm *PluginManager) Commands() []CommandInfo {
+	infos := make([]CommandInfo, 0)
 	for _, plugin := range pm.Plugins {
-		commands = append(commands, SupportedCommands(plugin)...)
-	}
-	bytes, err := json.Marshal(commands)
-	if err != nil {
-		return "Error encoding supported commands"
+		help := pm.CommandHelp(plugin)
+		commands := make([]string, 0, len(help))
+		for command := range help {
+			commands = append(commands, command)
+		}
+		sort.Strings(commands)
+		name := pm.PluginName(plugin)
+		for _, command := range commands {
+			infos = append(infos, CommandInfo{Plugin: name, Name: command, Command: help[command]})
+		}
 	}
-	return string(bytes)
+	return infos
 }
 
 func (pm *PluginManager) HealthCheck() []common.HealthStatus {
@@ -78,20 +150,146 @@ func (pm *PluginManager) HealthCheck() []common.HealthStatus {
 	var result []common.HealthStatus
 	logger.Logger.Info("Running healthcheck")
 	for _, plugin := range pm.Plugins {
-		plugin_health := plugin.HealthCheck()
-		plugin_health.Name = plugin.Name()
+		name := pm.PluginName(plugin)
+		plugin_health := pm.SafeHealthCheck(name, plugin.HealthCheck)
+		plugin_health.Name = name
 		result = append(result, plugin_health)
 		logger.Logger.Debug("Healthcheck done for ", "plugin", plugin_health.Name, "state", plugin_health.StateString)
+
+		if checker, ok := plugin.(ComponentChecker); ok {
+			var components []common.HealthStatus
+			pm.SafeCall(name, "component_health", func() {
+				components = checker.ComponentHealth()
+			})
+			for _, component := range components {
+				result = append(result, component.WithComponent(name+"/"+component.Name))
+			}
+		}
 	}
 	return result
 }
 
+// newDumpDir creates the directory of a dump under dumps/ of the diagnostic
+// directory. Dumps are named after the time they start, so they sort in
+// order, with a suffix when two start within the same second.
+func newDumpDir(dump_base_dir string) (string, error) {
+	parent := filepath.Join(dump_base_dir, "dumps")
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return "", err
+	}
+	name := filepath.Join(parent, "dump-"+time.Now().Format("20060102T150405"))
+	dir := name
+	for n := 2; ; n++ {
+		err := os.Mkdir(dir, 0755)
+		if !os.IsExist(err) {
+			return dir, err
+		}
+		dir = fmt.Sprintf("%s-%d", name, n)
+	}
+}
+
 func (pm *PluginManager) DiagnosticDump(dump_base_dir string) string {
-	// TODO: make this configurable
-	dump_dir_name := fmt.Sprintf("%s/dumps/dump-%s", dump_base_dir, time.Now().Format("20060102T150405"))
-	err := os.MkdirAll(dump_dir_name, 0755)
+	dump_dir_name, err := newDumpDir(dump_base_dir)
 	if err != nil {
 		logger.Logger.Error("Error creating dump directory", "error", err)
 	}
-	return pm.ExecuteCommand("diagnostic_dump", dump_dir_name)
+
+	// Plugins which cannot tell their commands, because they are quarantined
+	// or panicked, are listed as skipped rather than silently left out.
+	collectors := make([]Plugin, 0, len(pm.Plugins))
+	skipped := make([]string, 0)
+	for _, plugin := range pm.Plugins {
+		help, err := pm.commandHelp(plugin)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s: skipped, %s", pm.PluginName(plugin), err))
+			continue
+		}
+		if _, ok := help["diagnostic_dump"]; ok {
+			collectors = append(collectors, plugin)
+		}
+	}
+
+	// Run all collectors at once (bounded by dumpConcurrency) so the state
+	// they capture is as close as possible to the moment of failure.
+	// Results are kept in registration order to keep the output stable.
+	results := make([]string, len(collectors))
+	failed := make([]string, len(collectors))
+	var wg sync.WaitGroup
+	logger.Logger.Info("Starting diagnostic dump", "dir", dump_dir_name, "collectors", len(collectors), "concurrency", pm.dumpConcurrency)
+	for i, plugin := range collectors {
+		wg.Add(1)
+		go func(i int, plugin Plugin) {
+			defer wg.Done()
+			name := pm.PluginName(plugin)
+			start := time.Now()
+			output, err := pm.dumpWithDeadline(plugin, dump_dir_name)
+			if err != nil {
+				logger.Logger.Error("Error running diagnostic dump", "plugin", name, "duration", time.Since(start), "error", err)
+				failed[i] = fmt.Sprintf("%s: %s", name, err)
+				return
+			}
+			logger.Logger.Debug("Diagnostic dump done for", "plugin", name, "duration", time.Since(start))
+			results[i] = output
+		}(i, plugin)
+	}
+	wg.Wait()
+	pm.dumpPanics(dump_dir_name)
+
+	var result strings.Builder
+	for _, lines := range [][]string{results, failed, skipped} {
+		for _, line := range lines {
+			if line == "" {
+				continue
+			}
+			result.WriteString(line)
+			result.WriteString("\n")
+		}
+	}
+	if len(collectors) == 0 && len(skipped) == 0 {
+		return "Command diagnostic_dump not supported"
+	}
+	return result.String()
+}
+
+type dumpResult struct {
+	output string
+	err    error
+}
+
+// dumpWithDeadline runs the plugin's diagnostic_dump and gives up waiting once
+// the per-plugin deadline expires. Plugins cannot be interrupted, so a plugin
+// that is past its deadline keeps running in the background and its output is
+// discarded. It keeps its dump slot until it returns: when every slot is held
+// by such plugins, waiting for a slot gives up after the deadline as well.
+func (pm *PluginManager) dumpWithDeadline(plugin Plugin, dump_dir string) (string, error) {
+	name := pm.PluginName(plugin)
+	wait := time.NewTimer(pm.dumpTimeout)
+	select {
+	case pm.dumpSlots <- struct{}{}:
+		wait.Stop()
+	case <-wait.C:
+		return "", fmt.Errorf("no dump slot free after %s, %d earlier dumps still running", pm.dumpTimeout, len(pm.dumpSlots))
+	}
+
+	done := make(chan dumpResult, 1)
+	go func() {
+		defer func() { <-pm.dumpSlots }()
+		var res dumpResult
+		err := pm.SafeCall(name, "diagnostic_dump", func() {
+			res.output, res.err = plugin.Execute("diagnostic_dump", dump_dir)
+		})
+		if err != nil {
+			res.err = err
+		}
+		done <- res
+	}()
+
+	timer := time.NewTimer(pm.dumpTimeout)
+	defer timer.Stop()
+	select {
+	case res := <-done:
+		return res.output, res.err
+	case <-timer.C:
+		return "", fmt.Errorf("diagnostic dump timed out after %s", pm.dumpTimeout)
+	}
 }
@@ -0,0 +1,89 @@
+package plugin
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.cern.ch/eos/argeos/config"
+	"gitlab.cern.ch/eos/argeos/internal/common"
+	"gitlab.cern.ch/eos/argeos/internal/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	os.Exit(m.Run())
+}
+
+// dumpPlugin dumps after delay, or panics on every call when panicking
+type dumpPlugin struct {
+	name      string
+	delay     time.Duration
+	panicking bool
+}
+
+func (p *dumpPlugin) Name() string                     { return p.name }
+func (p *dumpPlugin) HealthCheck() common.HealthStatus { return common.HealthOK("") }
+
+func (p *dumpPlugin) CommandHelp() map[string]Command {
+	if p.panicking {
+		panic("broken")
+	}
+	return map[string]Command{"diagnostic_dump": {Args: []Arg{DumpDirArg}}}
+}
+
+func (p *dumpPlugin) Execute(command string, args ...string) (string, error) {
+	time.Sleep(p.delay)
+	return p.name + " dumped", nil
+}
+
+func TestDiagnosticDumpSkipsQuarantined(t *testing.T) {
+	pm := NewManager(config.ServerConfig{DumpConcurrency: 1, DumpTimeout: 5, PanicQuarantine: 1})
+	pm.Register(&dumpPlugin{name: "good"})
+	pm.Register(&dumpPlugin{name: "broken", panicking: true})
+
+	for _, want := range []string{"broken: skipped, plugin broken panicked", "broken: skipped, plugin broken is quarantined"} {
+		out := pm.DiagnosticDump(t.TempDir())
+		if !strings.Contains(out, "good dumped") || !strings.Contains(out, want) {
+			t.Errorf("got %q, want the good dump and %q", out, want)
+		}
+	}
+}
+
+func TestDiagnosticDumpHoldsSlotPastDeadline(t *testing.T) {
+	pm := NewManager(config.ServerConfig{DumpConcurrency: 1, DumpTimeout: 1})
+	pm.Register(&dumpPlugin{name: "hung", delay: 3 * time.Second})
+
+	out := pm.DiagnosticDump(t.TempDir())
+	if !strings.Contains(out, "hung: diagnostic dump timed out") {
+		t.Fatalf("got %q, want a timeout", out)
+	}
+	// the hung dump still runs, so the only slot is not free for the next one
+	pm.Plugins = []Plugin{&dumpPlugin{name: "next"}}
+	out = pm.DiagnosticDump(t.TempDir())
+	if !strings.Contains(out, "next: no dump slot free") {
+		t.Errorf("got %q, want no free slot", out)
+	}
+	time.Sleep(time.Second + 100*time.Millisecond)
+	if out := pm.DiagnosticDump(t.TempDir()); !strings.Contains(out, "next dumped") {
+		t.Errorf("got %q once the hung dump returned", out)
+	}
+}
+
+func TestNewDumpDir(t *testing.T) {
+	base := t.TempDir()
+	first, err := newDumpDir(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := newDumpDir(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Errorf("two dumps share %s", first)
+	}
+}
@@ -15,7 +15,7 @@ import (
 
 type ProbePlugin struct {
 	name        string
-	commandHelp map[string]string
+	commandHelp map[string]plugin.Command
 	nats_cfg    config.NatsConfig
 }
 
@@ -26,8 +26,8 @@ func NewPlugin(config config.Config) plugin.Plugin {
 	}
 	return &ProbePlugin{
 		name: "probe",
-		commandHelp: map[string]string{
-			"check_probe": "Check Probe Status",
+		commandHelp: map[string]plugin.Command{
+			"check_probe": {Description: "Check Probe Status"},
 		},
 		nats_cfg: _nats_cfg,
 	}
@@ -46,7 +46,7 @@ func (p *ProbePlugin) HealthCheck() common.HealthStatus {
 	return p.GetManualUpdates(store, hostname).WithComponent(p.Name())
 }
 
-func (p *ProbePlugin) CommandHelp() map[string]string {
+func (p *ProbePlugin) CommandHelp() map[string]plugin.Command {
 	return p.commandHelp
 }
 
@@ -0,0 +1,140 @@
+package process
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"gitlab.cern.ch/eos/argeos/internal/logger"
+)
+
+// BacktraceConfig Timeout is in seconds, for all the tools tried on a
+// process, and MaxOutput in bytes
+type BacktraceConfig struct {
+	Enabled   bool     `json:"enabled"`
+	Tools     []string `json:"tools"`
+	Timeout   int32    `json:"timeout"`
+	MaxOutput int      `json:"max_output"`
+}
+
+const (
+	DefaultBacktraceTimeout   = 60
+	DefaultBacktraceMaxOutput = 16 << 20
+)
+
+var DefaultBacktraceTools = []string{"eu-stack", "gdb", "pstack"}
+
+// backtraceArgs returns the arguments to dump all the threads of pid
+var backtraceArgs = map[string]func(pid string) []string{
+	"eu-stack": func(pid string) []string { return []string{"-p", pid} },
+	"gdb": func(pid string) []string {
+		return []string{"-p", pid, "-batch", "-nx", "-ex", "set pagination off", "-ex", "thread apply all bt"}
+	},
+	"pstack": func(pid string) []string { return []string{pid} },
+}
+
+func (cfg *BacktraceConfig) setDefaults() {
+	if len(cfg.Tools) == 0 {
+		cfg.Tools = DefaultBacktraceTools
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultBacktraceTimeout
+	}
+	if cfg.MaxOutput <= 0 {
+		cfg.MaxOutput = DefaultBacktraceMaxOutput
+	}
+}
+
+// cappedBuffer keeps the first max bytes written to it and drops the rest, so
+// a process with thousands of threads cannot fill up the dump directory.
+type cappedBuffer struct {
+	bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); len(p) > room {
+		b.truncated = true
+		b.Buffer.Write(p[:max(room, 0)])
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// runBacktrace runs one tool against pid until the deadline of ctx. Tools are
+// asked to terminate (and thus detach) at the deadline, and only killed if
+// they do not.
+func (cfg BacktraceConfig) runBacktrace(ctx context.Context, tool string, pid int) ([]byte, bool, error) {
+	argsFor, ok := backtraceArgs[filepath.Base(tool)]
+	if !ok {
+		return nil, false, fmt.Errorf("unsupported backtrace tool %s", tool)
+	}
+	path, err := exec.LookPath(tool)
+	if err != nil {
+		return nil, false, err
+	}
+
+	cmd := exec.CommandContext(ctx, path, argsFor(strconv.Itoa(pid))...)
+	cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+	cmd.WaitDelay = 5 * time.Second
+	out := &cappedBuffer{max: cfg.MaxOutput}
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	start := time.Now()
+	err = cmd.Run()
+	if ctx.Err() != nil {
+		err = fmt.Errorf("%s stopped at the deadline after %s", tool, time.Since(start).Round(time.Second))
+	}
+	return out.Bytes(), out.truncated, err
+}
+
+// Backtrace tries the configured tools in order until one succeeds, all of
+// them within a single Timeout, shortened to the deadline of ctx if that
+// comes first. When all of them fail, the (partial) output of the last one is
+// returned.
+func (cfg BacktraceConfig) Backtrace(ctx context.Context, pid int) (string, []byte, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(cfg.Timeout)*time.Second)
+	defer cancel()
+
+	lastErr := errors.New("no backtrace tool configured")
+	var lastOut []byte
+	var lastTruncated bool
+	for _, tool := range cfg.Tools {
+		if ctx.Err() != nil {
+			logger.Logger.Warn("No time left for the next backtrace tool", "tool", tool, "pid", pid)
+			break
+		}
+		out, truncated, err := cfg.runBacktrace(ctx, tool, pid)
+		if err == nil {
+			return tool, out, truncated, nil
+		}
+		logger.Logger.Warn("Backtrace tool failed, trying next one", "tool", tool, "pid", pid, "error", err)
+		lastErr, lastOut, lastTruncated = err, out, truncated
+	}
+	return "", lastOut, lastTruncated, fmt.Errorf("no backtrace tool succeeded, last error: %w", lastErr)
+}
+
+func (cfg BacktraceConfig) dumpBacktrace(ctx context.Context, dir string, pid int) {
+	start := time.Now()
+	tool, out, truncated, err := cfg.Backtrace(ctx, pid)
+
+	var buf bytes.Buffer
+	if err != nil {
+		fmt.Fprintf(&buf, "# error: %s\n", err)
+	} else {
+		fmt.Fprintf(&buf, "# tool: %s, duration: %s, truncated: %t\n", tool, time.Since(start).Round(time.Millisecond), truncated)
+	}
+	buf.Write(out)
+	if err := os.WriteFile(filepath.Join(dir, "backtrace.txt"), buf.Bytes(), 0644); err != nil {
+		logger.Logger.Error("Error writing backtrace", "pid", pid, "error", err)
+	}
+}
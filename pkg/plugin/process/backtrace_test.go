@@ -0,0 +1,147 @@
+package process
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.cern.ch/eos/argeos/internal/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	os.Exit(m.Run())
+}
+
+func TestCappedBuffer(t *testing.T) {
+	tests := []struct {
+		name          string
+		max           int
+		writes        []string
+		want          string
+		wantTruncated bool
+	}{
+		{name: "below the cap", max: 10, writes: []string{"abc", "def"}, want: "abcdef"},
+		{name: "exactly the cap", max: 6, writes: []string{"abc", "def"}, want: "abcdef"},
+		{name: "write crossing the cap", max: 4, writes: []string{"abc", "def"}, want: "abcd", wantTruncated: true},
+		{name: "writes past the cap", max: 3, writes: []string{"abc", "def", "ghi"}, want: "abc", wantTruncated: true},
+		{name: "no room at all", max: 0, writes: []string{"abc"}, want: "", wantTruncated: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &cappedBuffer{max: tt.max}
+			for _, w := range tt.writes {
+				// writes never fail, so that the tool is not killed by SIGPIPE
+				if n, err := b.Write([]byte(w)); n != len(w) || err != nil {
+					t.Fatalf("write %q: got %d, %v", w, n, err)
+				}
+			}
+			if b.String() != tt.want || b.truncated != tt.wantTruncated {
+				t.Errorf("got %q truncated %t, want %q truncated %t", b.String(), b.truncated, tt.want, tt.wantTruncated)
+			}
+		})
+	}
+}
+
+// fakeTools writes stand-ins for the backtrace tools, named like the real
+// ones since their arguments are picked by name
+func fakeTools(t *testing.T, scripts map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, script := range scripts {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestBacktraceFallback(t *testing.T) {
+	dir := fakeTools(t, map[string]string{
+		"eu-stack": `echo "eu-stack: cannot attach"; exit 1`,
+		"gdb":      `echo "gdb $*"`,
+		"pstack":   `echo "pstack $*"`,
+	})
+	tests := []struct {
+		name     string
+		tools    []string
+		wantTool string
+		wantOut  string
+		wantErr  bool
+	}{
+		{
+			name:     "first working tool",
+			tools:    []string{"eu-stack", "gdb", "pstack"},
+			wantTool: "gdb",
+			wantOut:  "gdb -p 42 -batch -nx -ex set pagination off -ex thread apply all bt\n",
+		},
+		{
+			name:     "configured order",
+			tools:    []string{"pstack", "gdb"},
+			wantTool: "pstack",
+			wantOut:  "pstack 42\n",
+		},
+		{
+			name:     "unsupported and missing tools skipped",
+			tools:    []string{"strace", "missing/gdb", "pstack"},
+			wantTool: "pstack",
+			wantOut:  "pstack 42\n",
+		},
+		{
+			name:    "all failing, output of the last one",
+			tools:   []string{"strace", "eu-stack"},
+			wantOut: "eu-stack: cannot attach\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := BacktraceConfig{Timeout: 10, MaxOutput: 1024}
+			for _, tool := range tt.tools {
+				cfg.Tools = append(cfg.Tools, filepath.Join(dir, tool))
+			}
+			tool, out, _, err := cfg.Backtrace(context.Background(), 42)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantTool != "" && tool != filepath.Join(dir, tt.wantTool) {
+				t.Errorf("got tool %s, want %s", tool, tt.wantTool)
+			}
+			if string(out) != tt.wantOut {
+				t.Errorf("got %q, want %q", out, tt.wantOut)
+			}
+		})
+	}
+}
+
+func TestBacktraceSingleDeadline(t *testing.T) {
+	dir := fakeTools(t, map[string]string{
+		"eu-stack": "exec sleep 30",
+		"gdb":      "exec sleep 30",
+		"pstack":   "echo too late",
+	})
+	cfg := BacktraceConfig{MaxOutput: 1024, Timeout: 60}
+	for _, tool := range []string{"eu-stack", "gdb", "pstack"} {
+		cfg.Tools = append(cfg.Tools, filepath.Join(dir, tool))
+	}
+
+	// the dump deadline is shorter than the timeout and shared by all tools
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	_, out, _, err := cfg.Backtrace(ctx, 42)
+	if err == nil || !strings.Contains(err.Error(), "eu-stack stopped at the deadline") {
+		t.Errorf("got %v, want eu-stack stopped", err)
+	}
+	if len(out) != 0 {
+		t.Errorf("got %q from a tool run after the deadline", out)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("took %s, want the deadline of 1s for all tools", elapsed)
+	}
+}
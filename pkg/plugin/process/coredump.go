@@ -0,0 +1,281 @@
+package process
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"gitlab.cern.ch/eos/argeos/internal/logger"
+	"gitlab.cern.ch/eos/argeos/internal/procfs"
+)
+
+const (
+	TriggerDump   = "dump"   // capture a core on every diagnostic dump
+	TriggerManual = "manual" // only capture with the core_dump command
+)
+
+// CoreDumpConfig sizes are in MiB and Timeout in seconds. Cores are only
+// taken of the listed Targets, or of all targets when empty.
+type CoreDumpConfig struct {
+	Enabled     bool     `json:"enabled"`
+	Trigger     string   `json:"trigger"`
+	Targets     []string `json:"targets"`
+	Tool        string   `json:"tool"`
+	Timeout     int32    `json:"timeout"`
+	MaxSizeMB   uint64   `json:"max_size_mb"`
+	MinFreeMB   uint64   `json:"min_free_mb"`
+	MaxPerDay   int      `json:"max_per_day"`
+	Compression string   `json:"compression"` // gzip or none
+}
+
+const (
+	DefaultCoreTool      = "gcore"
+	DefaultCoreTimeout   = 600
+	DefaultCoreMaxSizeMB = 16384
+	DefaultCoreMinFreeMB = 10240
+	DefaultCoreMaxPerDay = 1
+)
+
+func (cfg *CoreDumpConfig) setDefaults() {
+	if cfg.Trigger == "" {
+		cfg.Trigger = TriggerManual
+	}
+	if cfg.Tool == "" {
+		cfg.Tool = DefaultCoreTool
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultCoreTimeout
+	}
+	if cfg.MaxSizeMB == 0 {
+		cfg.MaxSizeMB = DefaultCoreMaxSizeMB
+	}
+	if cfg.MinFreeMB == 0 {
+		cfg.MinFreeMB = DefaultCoreMinFreeMB
+	}
+	if cfg.MaxPerDay <= 0 {
+		cfg.MaxPerDay = DefaultCoreMaxPerDay
+	}
+	if cfg.Compression == "" {
+		cfg.Compression = "gzip"
+	}
+}
+
+func (cfg CoreDumpConfig) wants(target string) bool {
+	if len(cfg.Targets) == 0 {
+		return true
+	}
+	for _, name := range cfg.Targets {
+		if name == target {
+			return true
+		}
+	}
+	return false
+}
+
+// coreDumper serializes core captures and remembers when they were taken, in
+// a state file so that the daily limit survives restarts.
+type coreDumper struct {
+	cfg       CoreDumpConfig
+	stateFile string
+
+	mu sync.Mutex
+}
+
+func (cd *coreDumper) history() []time.Time {
+	var history []time.Time
+	data, err := os.ReadFile(cd.stateFile)
+	if err != nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, &history); err != nil {
+		logger.Logger.Warn("Ignoring corrupt core dump state file", "file", cd.stateFile, "error", err)
+		return nil
+	}
+	return history
+}
+
+// recordCapture stores the capture time, dropping entries older than a day
+func (cd *coreDumper) recordCapture(now time.Time, history []time.Time) {
+	recent := []time.Time{now}
+	for _, t := range history {
+		if now.Sub(t) < 24*time.Hour {
+			recent = append(recent, t)
+		}
+	}
+	data, _ := json.Marshal(recent)
+	err := os.MkdirAll(filepath.Dir(cd.stateFile), 0755)
+	if err == nil {
+		err = os.WriteFile(cd.stateFile, data, 0644)
+	}
+	if err != nil {
+		logger.Logger.Error("Error writing core dump state file", "file", cd.stateFile, "error", err)
+	}
+}
+
+func freeMB(dir string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return st.Bavail * uint64(st.Bsize) >> 20, nil
+}
+
+func rssMB(pid int) (uint64, error) {
+	rss, err := procfs.StatusField(pid, "VmRSS")
+	if err != nil {
+		return 0, err
+	}
+	kb, err := strconv.ParseUint(strings.TrimSuffix(rss, " kB"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected VmRSS %q", rss)
+	}
+	return kb >> 10, nil
+}
+
+// checkLimits refuses the capture if it would exceed the daily limit, the
+// maximum core size or eat into the space we need to leave free. The core is
+// estimated at the process RSS, and twice that while it is being compressed.
+func (cd *coreDumper) checkLimits(dir string, pid int, now time.Time, history []time.Time) error {
+	taken := 0
+	for _, t := range history {
+		if now.Sub(t) < 24*time.Hour {
+			taken++
+		}
+	}
+	if taken >= cd.cfg.MaxPerDay {
+		return fmt.Errorf("already took %d core dumps in the last 24h", taken)
+	}
+
+	estimate, err := rssMB(pid)
+	if err != nil {
+		return err
+	}
+	if estimate > cd.cfg.MaxSizeMB {
+		return fmt.Errorf("process rss %dMiB exceeds max_size_mb %d", estimate, cd.cfg.MaxSizeMB)
+	}
+	if cd.cfg.Compression == "gzip" {
+		estimate *= 2
+	}
+	free, err := freeMB(dir)
+	if err != nil {
+		return err
+	}
+	if free < estimate+cd.cfg.MinFreeMB {
+		return fmt.Errorf("only %dMiB free in %s, need %dMiB plus min_free_mb %d", free, dir, estimate, cd.cfg.MinFreeMB)
+	}
+	return nil
+}
+
+func compressFile(path string) (string, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	gzPath := path + ".gz"
+	out, err := os.Create(gzPath)
+	if err != nil {
+		return "", err
+	}
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(gzPath)
+		return "", err
+	}
+	return gzPath, os.Remove(path)
+}
+
+// coreStatusFile is where a capture started by a diagnostic dump records its
+// progress and then the core path or why there is none
+const coreStatusFile = "core_dump.txt"
+
+// CaptureInBackground starts taking a core of pid into dir without waiting
+// for it: gcore and the compression of a large process take much longer than
+// a dump may. Its status is kept up to date in coreStatusFile in dir.
+func (cd *coreDumper) CaptureInBackground(dir string, pid int) {
+	status := filepath.Join(dir, coreStatusFile)
+	writeStatus := func(format string, args ...any) {
+		if err := os.WriteFile(status, []byte(fmt.Sprintf(format+"\n", args...)), 0644); err != nil {
+			logger.Logger.Error("Error writing core dump status", "file", status, "error", err)
+		}
+	}
+	writeStatus("in progress since %s", time.Now().Format(time.RFC3339))
+	go func() {
+		core, err := cd.Capture(dir, pid)
+		if err != nil {
+			logger.Logger.Error("Error taking core dump", "pid", pid, "error", err)
+			writeStatus("error: %s", err)
+			return
+		}
+		logger.Logger.Info("Took core dump", "pid", pid, "core", core)
+		writeStatus("%s", core)
+	}()
+}
+
+// Capture takes a core of pid into dir, returning the path of the core file
+func (cd *coreDumper) Capture(dir string, pid int) (string, error) {
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	history := cd.history()
+	if err := cd.checkLimits(dir, pid, now, history); err != nil {
+		os.Remove(dir) // only if we just created it empty
+		return "", fmt.Errorf("not taking core dump of pid %d: %w", pid, err)
+	}
+	// count attempts rather than successes, a failing gcore should not be
+	// retried on every dump either
+	cd.recordCapture(now, history)
+
+	prefix := filepath.Join(dir, "core")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cd.cfg.Timeout)*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, cd.cfg.Tool, "-o", prefix, strconv.Itoa(pid))
+	cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+	cmd.WaitDelay = 10 * time.Second
+	logger.Logger.Warn("Taking core dump", "pid", pid, "tool", cd.cfg.Tool, "dir", dir)
+	out, err := cmd.CombinedOutput()
+	corePath := fmt.Sprintf("%s.%d", prefix, pid)
+	if ctx.Err() != nil {
+		os.Remove(corePath)
+		return "", fmt.Errorf("%s timed out after %ds", cd.cfg.Tool, cd.cfg.Timeout)
+	}
+	if err != nil {
+		os.Remove(corePath)
+		return "", fmt.Errorf("%s failed: %w: %s", cd.cfg.Tool, err, strings.TrimSpace(string(out)))
+	}
+
+	info, err := os.Stat(corePath)
+	if err != nil {
+		return "", err
+	}
+	if uint64(info.Size())>>20 > cd.cfg.MaxSizeMB {
+		os.Remove(corePath)
+		return "", fmt.Errorf("core of %dMiB exceeds max_size_mb %d, removed", info.Size()>>20, cd.cfg.MaxSizeMB)
+	}
+	if cd.cfg.Compression == "gzip" {
+		return compressFile(corePath)
+	}
+	return corePath, nil
+}
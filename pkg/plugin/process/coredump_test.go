@@ -0,0 +1,118 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.cern.ch/eos/argeos/internal/procfs"
+)
+
+const corePid = 4242
+
+// newTestDumper returns a dumper running gcore, a stand-in writing a core of
+// coreMB MiB or sleeping when coreMB is negative, against a process of 1MiB
+func newTestDumper(t *testing.T, coreMB int, cfg CoreDumpConfig) *coreDumper {
+	t.Helper()
+	previous := procfs.Root
+	t.Cleanup(func() { procfs.Root = previous })
+	procfs.Root = t.TempDir()
+	if err := os.MkdirAll(procfs.PidPath(corePid), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(procfs.PidPath(corePid, "status"), []byte("Name:\txrootd\nVmRSS:\t    1024 kB\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// gcore -o <prefix> <pid> writes <prefix>.<pid>
+	script := fmt.Sprintf(`head -c %d /dev/zero > "$2.$3"`, coreMB<<20)
+	if coreMB < 0 {
+		script = "exec sleep 30"
+	}
+	cfg.Tool = filepath.Join(t.TempDir(), "gcore")
+	if err := os.WriteFile(cfg.Tool, []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 10
+	}
+	if cfg.MaxPerDay == 0 {
+		cfg.MaxPerDay = 10
+	}
+	cfg.MinFreeMB = 1
+	return &coreDumper{cfg: cfg, stateFile: filepath.Join(t.TempDir(), "core_dumps.json")}
+}
+
+func TestCapture(t *testing.T) {
+	tests := []struct {
+		name     string
+		coreMB   int
+		cfg      CoreDumpConfig
+		wantCore string
+		wantErr  string
+	}{
+		{name: "gzipped", coreMB: 1, cfg: CoreDumpConfig{MaxSizeMB: 4, Compression: "gzip"}, wantCore: "core.4242.gz"},
+		{name: "uncompressed", coreMB: 1, cfg: CoreDumpConfig{MaxSizeMB: 4, Compression: "none"}, wantCore: "core.4242"},
+		{name: "core above max_size_mb", coreMB: 3, cfg: CoreDumpConfig{MaxSizeMB: 2}, wantErr: "exceeds max_size_mb 2, removed"},
+		{name: "rss above max_size_mb", coreMB: 1, cfg: CoreDumpConfig{MaxSizeMB: 0}, wantErr: "process rss 1MiB exceeds max_size_mb 0"},
+		{name: "timeout", coreMB: -1, cfg: CoreDumpConfig{MaxSizeMB: 4, Timeout: 1}, wantErr: "timed out after 1s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cd := newTestDumper(t, tt.coreMB, tt.cfg)
+			dir := t.TempDir()
+			core, err := cd.Capture(dir, corePid)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("got %v, want %q", err, tt.wantErr)
+				}
+				if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+					t.Errorf("left %d files behind", len(entries))
+				}
+				return
+			}
+			if err != nil || core != filepath.Join(dir, tt.wantCore) {
+				t.Fatalf("got %s, %v, want %s", core, err, tt.wantCore)
+			}
+			if _, err := os.Stat(core); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestCaptureDailyLimit(t *testing.T) {
+	cd := newTestDumper(t, 1, CoreDumpConfig{MaxSizeMB: 4, MaxPerDay: 1, Compression: "none"})
+	if _, err := cd.Capture(t.TempDir(), corePid); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cd.Capture(t.TempDir(), corePid); err == nil || !strings.Contains(err.Error(), "already took 1") {
+		t.Errorf("got %v, want the daily limit", err)
+	}
+}
+
+func TestCaptureInBackground(t *testing.T) {
+	cd := newTestDumper(t, 1, CoreDumpConfig{MaxSizeMB: 4, Compression: "none"})
+	dir := t.TempDir()
+	status := filepath.Join(dir, coreStatusFile)
+	cd.mu.Lock() // hold the capture back to see it in progress
+	cd.CaptureInBackground(dir, corePid)
+	if data, err := os.ReadFile(status); err != nil || !strings.HasPrefix(string(data), "in progress since") {
+		t.Errorf("got %q, %v, want in progress", data, err)
+	}
+	cd.mu.Unlock()
+
+	want := filepath.Join(dir, "core.4242") + "\n"
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if data, _ := os.ReadFile(status); string(data) == want {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	data, _ := os.ReadFile(status)
+	t.Errorf("got %q, want the core path", data)
+}
@@ -0,0 +1,339 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gitlab.cern.ch/eos/argeos/config"
+	"gitlab.cern.ch/eos/argeos/internal/common"
+	"gitlab.cern.ch/eos/argeos/internal/logger"
+	"gitlab.cern.ch/eos/argeos/internal/procfs"
+	"gitlab.cern.ch/eos/argeos/pkg/plugin"
+)
+
+// PluginConfig DumpTimeout bounds a diagnostic dump in seconds, it should stay
+// below the server dump_timeout so that the dump returns what it collected.
+type PluginConfig struct {
+	Targets     []procfs.Target `json:"targets"`
+	Backtrace   BacktraceConfig `json:"backtrace"`
+	CoreDump    CoreDumpConfig  `json:"core_dump"`
+	DumpTimeout int32           `json:"dump_timeout"`
+}
+
+const DefaultDumpTimeout = 240
+
+type ProcessPlugin struct {
+	name        string
+	commandHelp map[string]plugin.Command
+	config      PluginConfig
+	coreDumper  *coreDumper
+}
+
+// procFiles are copied verbatim for every target process
+var procFiles = []string{"status", "stat", "limits", "io", "sched", "schedstat", "wchan", "stack", "cgroup", "smaps_rollup"}
+
+func NewPlugin(cfg config.Config) plugin.Plugin {
+	var pluginConfig PluginConfig
+	if err := plugin.DecodeConfig(cfg, "process", &pluginConfig); err != nil {
+		logger.Logger.Error("Error decoding process plugin config", "error", err)
+	}
+	pluginConfig.Backtrace.setDefaults()
+	pluginConfig.CoreDump.setDefaults()
+	if pluginConfig.DumpTimeout <= 0 {
+		pluginConfig.DumpTimeout = DefaultDumpTimeout
+	}
+
+	commandHelp := map[string]plugin.Command{
+		"process_status": {Description: "Show thread states and resource usage of the target processes", Args: []plugin.Arg{
+			{Name: "target", Type: plugin.ArgString, Description: "Only show this target"},
+		}},
+		"backtrace": {Description: "Show the userspace backtraces of all threads of a target", Args: []plugin.Arg{
+			{Name: "target", Type: plugin.ArgString, Required: true, Description: "Name of the target"},
+		}},
+		"diagnostic_dump": {Description: "Dump /proc state and backtraces of the target processes", Args: []plugin.Arg{plugin.DumpDirArg}},
+	}
+	if pluginConfig.CoreDump.Enabled {
+		commandHelp["core_dump"] = plugin.Command{Description: "Take a core dump of a target, within the configured limits", Args: []plugin.Arg{
+			{Name: "target", Type: plugin.ArgString, Required: true, Description: "Name of the target"},
+			{Name: "dir", Type: plugin.ArgPath, Default: filepath.Join(cfg.Server.DiagnosticDir, "cores"), Description: "Directory to write the core to"},
+		}}
+	}
+
+	return &ProcessPlugin{
+		name:        "process",
+		commandHelp: commandHelp,
+		config:      pluginConfig,
+		coreDumper: &coreDumper{
+			cfg:       pluginConfig.CoreDump,
+			stateFile: filepath.Join(cfg.Server.DiagnosticDir, "core_dumps.json"),
+		},
+	}
+}
+
+func (pp *ProcessPlugin) Name() string {
+	return pp.name
+}
+
+func (pp *ProcessPlugin) CommandHelp() map[string]plugin.Command {
+	return pp.commandHelp
+}
+
+func (pp *ProcessPlugin) targets(name string) []procfs.Target {
+	if name == "" {
+		return pp.config.Targets
+	}
+	for _, target := range pp.config.Targets {
+		if target.Name == name {
+			return []procfs.Target{target}
+		}
+	}
+	return nil
+}
+
+type threadInfo struct {
+	tid   int
+	stat  procfs.Stat
+	wchan string
+}
+
+func threads(pid int) []threadInfo {
+	tids, err := procfs.Threads(pid)
+	if err != nil {
+		logger.Logger.Debug("Error listing threads", "pid", pid, "error", err)
+		return nil
+	}
+	infos := make([]threadInfo, 0, len(tids))
+	for _, tid := range tids {
+		stat, err := procfs.ThreadStat(pid, tid)
+		if err != nil {
+			continue
+		}
+		infos = append(infos, threadInfo{tid: tid, stat: stat, wchan: procfs.Wchan(pid, tid)})
+	}
+	return infos
+}
+
+func stateSummary(infos []threadInfo) string {
+	counts := make(map[string]int)
+	for _, info := range infos {
+		counts[info.stat.State]++
+	}
+	states := make([]string, 0, len(counts))
+	for state, count := range counts {
+		states = append(states, fmt.Sprintf("%s:%d", state, count))
+	}
+	sort.Strings(states)
+	return strings.Join(states, " ")
+}
+
+func (pp *ProcessPlugin) status(name string) (string, error) {
+	targets := pp.targets(name)
+	if len(targets) == 0 {
+		return "", fmt.Errorf("no such target %q", name)
+	}
+
+	var out strings.Builder
+	for _, target := range targets {
+		pids, err := target.Resolve()
+		if err != nil {
+			fmt.Fprintf(&out, "%s: %s\n", target.Name, err)
+			continue
+		}
+		if len(pids) == 0 {
+			fmt.Fprintf(&out, "%s: not running\n", target.Name)
+			continue
+		}
+		for _, pid := range pids {
+			stat, err := procfs.ProcessStat(pid)
+			if err != nil {
+				fmt.Fprintf(&out, "%s: pid %d: %s\n", target.Name, pid, err)
+				continue
+			}
+			infos := threads(pid)
+			rss, _ := procfs.StatusField(pid, "VmRSS")
+			fds, _ := procfs.Fds(pid)
+			fmt.Fprintf(&out, "%s: pid=%d comm=%s state=%s threads=%d (%s) rss=%s fds=%d\n",
+				target.Name, pid, stat.Comm, stat.State, len(infos), stateSummary(infos), rss, len(fds))
+		}
+	}
+	return out.String(), nil
+}
+
+func (pp *ProcessPlugin) backtrace(name string) (string, error) {
+	targets := pp.targets(name)
+	if len(targets) == 0 {
+		return "", fmt.Errorf("no such target %q", name)
+	}
+	pids, err := targets[0].Resolve()
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	for _, pid := range pids {
+		tool, trace, truncated, err := pp.config.Backtrace.Backtrace(context.Background(), pid)
+		if err != nil {
+			fmt.Fprintf(&out, "=== pid %d: %s ===\n%s\n", pid, err, trace)
+			continue
+		}
+		fmt.Fprintf(&out, "=== pid %d (%s, truncated: %t) ===\n%s\n", pid, tool, truncated, trace)
+	}
+	return out.String(), nil
+}
+
+func (pp *ProcessPlugin) coreDump(name string, dir string) (string, error) {
+	if !pp.config.CoreDump.Enabled || !pp.config.CoreDump.wants(name) {
+		return "", fmt.Errorf("core dumps are not enabled for target %q", name)
+	}
+	targets := pp.targets(name)
+	if len(targets) == 0 {
+		return "", fmt.Errorf("no such target %q", name)
+	}
+	pids, err := targets[0].Resolve()
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	for _, pid := range pids {
+		core, err := pp.coreDumper.Capture(filepath.Join(dir, fmt.Sprintf("%s-%d-%s", name, pid, time.Now().Format("20060102T150405"))), pid)
+		if err != nil {
+			fmt.Fprintf(&out, "pid %d: %s\n", pid, err)
+			continue
+		}
+		fmt.Fprintf(&out, "pid %d: %s\n", pid, core)
+	}
+	return out.String(), nil
+}
+
+// copyProcFile copies a /proc file to the dump, recording the error in its
+// place since many of them need privileges we may not have.
+func copyProcFile(src string, dst string) {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		data = []byte(fmt.Sprintf("error: %s\n", err))
+	}
+	if err := os.WriteFile(dst, data, 0644); err != nil {
+		logger.Logger.Error("Error writing dump file", "file", dst, "error", err)
+	}
+}
+
+func dumpProcess(dir string, pid int) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, name := range procFiles {
+		copyProcFile(procfs.PidPath(pid, name), filepath.Join(dir, name))
+	}
+
+	if cmdline, err := procfs.Cmdline(pid); err == nil {
+		os.WriteFile(filepath.Join(dir, "cmdline"), []byte(strings.Join(cmdline, " ")+"\n"), 0644)
+	}
+
+	var fdOut strings.Builder
+	fds, err := procfs.Fds(pid)
+	if err != nil {
+		fmt.Fprintf(&fdOut, "error: %s\n", err)
+	}
+	for _, fd := range fds {
+		fmt.Fprintf(&fdOut, "%d -> %s\n", fd.Fd, fd.Target)
+	}
+	os.WriteFile(filepath.Join(dir, "fds.txt"), []byte(fdOut.String()), 0644)
+
+	var threadOut, stackOut strings.Builder
+	fmt.Fprintf(&threadOut, "%-8s %-5s %-32s %s\n", "TID", "STATE", "WCHAN", "COMM")
+	for _, info := range threads(pid) {
+		fmt.Fprintf(&threadOut, "%-8d %-5s %-32s %s\n", info.tid, info.stat.State, info.wchan, info.stat.Comm)
+		stack, err := os.ReadFile(procfs.TaskPath(pid, info.tid, "stack"))
+		if err != nil {
+			stack = []byte(fmt.Sprintf("error: %s\n", err))
+		}
+		fmt.Fprintf(&stackOut, "=== tid %d (%s) state %s wchan %s ===\n%s\n", info.tid, info.stat.Comm, info.stat.State, info.wchan, stack)
+	}
+	os.WriteFile(filepath.Join(dir, "threads.txt"), []byte(threadOut.String()), 0644)
+	os.WriteFile(filepath.Join(dir, "stacks.txt"), []byte(stackOut.String()), 0644)
+	return nil
+}
+
+func (pp *ProcessPlugin) diagnosticDump(dumpDir string) (string, error) {
+	processDir := filepath.Join(dumpDir, "process")
+	if err := os.MkdirAll(processDir, 0755); err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(pp.config.DumpTimeout)*time.Second)
+	defer cancel()
+
+	dumped, cores := 0, 0
+	for _, target := range pp.config.Targets {
+		pids, err := target.Resolve()
+		if err != nil {
+			logger.Logger.Error("Error resolving target", "target", target.Name, "error", err)
+			continue
+		}
+		for _, pid := range pids {
+			dir := filepath.Join(processDir, fmt.Sprintf("%s-%d", target.Name, pid))
+			if err := dumpProcess(dir, pid); err != nil {
+				logger.Logger.Error("Error dumping process", "target", target.Name, "pid", pid, "error", err)
+				continue
+			}
+			if pp.config.Backtrace.Enabled {
+				pp.config.Backtrace.dumpBacktrace(ctx, dir, pid)
+			}
+			if pp.config.CoreDump.Enabled && pp.config.CoreDump.Trigger == TriggerDump && pp.config.CoreDump.wants(target.Name) {
+				pp.coreDumper.CaptureInBackground(dir, pid)
+				cores++
+			}
+			dumped++
+		}
+	}
+	result := fmt.Sprintf("process: dumped %d processes of %d targets", dumped, len(pp.config.Targets))
+	if cores > 0 {
+		result += fmt.Sprintf(", %d core dumps continuing in the background, see %s", cores, coreStatusFile)
+	}
+	return result, nil
+}
+
+func (pp *ProcessPlugin) Execute(command string, args ...string) (string, error) {
+	switch command {
+	case "process_status":
+		target := ""
+		if len(args) > 0 {
+			target = args[0]
+		}
+		return pp.status(target)
+	case "backtrace":
+		return pp.backtrace(args[0])
+	case "core_dump":
+		return pp.coreDump(args[0], args[1])
+	case "diagnostic_dump":
+		if len(args) < 1 {
+			return "", fmt.Errorf("no diagnostic directory provided")
+		}
+		return pp.diagnosticDump(args[0])
+	default:
+		return "", fmt.Errorf("command not implemented")
+	}
+}
+
+func (pp *ProcessPlugin) HealthCheck() common.HealthStatus {
+	if len(pp.config.Targets) == 0 {
+		return common.HealthWARN("No target processes configured")
+	}
+
+	missing := make([]string, 0)
+	for _, target := range pp.config.Targets {
+		pids, err := target.Resolve()
+		if err != nil || len(pids) == 0 {
+			missing = append(missing, target.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return common.HealthWARN(fmt.Sprintf("Target processes not found: %s", strings.Join(missing, ", ")))
+	}
+	return common.HealthOK(fmt.Sprintf("All %d target processes found", len(pp.config.Targets)))
+}
@@ -0,0 +1,68 @@
+package plugin
+
+import (
+	"context"
+	"time"
+
+	"gitlab.cern.ch/eos/argeos/internal/logger"
+)
+
+// Supervised is implemented by plugins that run outside of the argeos process
+// and have to be launched, and relaunched on crash, by the PluginManager.
+type Supervised interface {
+	Plugin
+	Launch() error // Start the plugin process and complete the handshake
+	Wait() error   // Block until the plugin process exits
+	Shutdown()     // Terminate the plugin process
+}
+
+const (
+	minRestartDelay = 1 * time.Second
+	maxRestartDelay = 300 * time.Second
+	// a plugin that stayed up for this long is considered healthy again
+	stableRunDuration = 60 * time.Second
+)
+
+// Start launches all the supervised plugins and keeps them running until the
+// context is cancelled.
+func (pm *PluginManager) Start(ctx context.Context) {
+	for _, plugin := range pm.Plugins {
+		if sp, ok := plugin.(Supervised); ok {
+			go pm.supervise(ctx, sp)
+		}
+	}
+}
+
+func (pm *PluginManager) supervise(ctx context.Context, sp Supervised) {
+	name := pm.PluginName(sp)
+	delay := minRestartDelay
+	for {
+		started := time.Now()
+		err := sp.Launch()
+		if err == nil {
+			logger.Logger.Info("Launched supervised plugin", "plugin", name)
+			exited := make(chan error, 1)
+			go func() { exited <- sp.Wait() }()
+			select {
+			case <-ctx.Done():
+				logger.Logger.Info("Stopping supervised plugin", "plugin", name)
+				sp.Shutdown()
+				<-exited
+				return
+			case err = <-exited:
+			}
+		}
+
+		if time.Since(started) > stableRunDuration {
+			delay = minRestartDelay
+		}
+		logger.Logger.Error("Supervised plugin exited, restarting", "plugin", name, "error", err, "delay", delay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxRestartDelay)
+	}
+}
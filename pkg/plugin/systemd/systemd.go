@@ -0,0 +1,231 @@
+package systemd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.cern.ch/eos/argeos/config"
+	"gitlab.cern.ch/eos/argeos/internal/common"
+	"gitlab.cern.ch/eos/argeos/internal/logger"
+	"gitlab.cern.ch/eos/argeos/pkg/plugin"
+)
+
+// PluginConfig JournalWindow is the number of seconds of journal exported
+// before the dump. Systemctl and Journalctl can point to stand-in binaries.
+type PluginConfig struct {
+	Units         []string `json:"units"`
+	Systemctl     string   `json:"systemctl"`
+	Journalctl    string   `json:"journalctl"`
+	JournalWindow int32    `json:"journal_window"`
+}
+
+const (
+	DefaultJournalWindow = 3600
+	commandJournalLines  = "500"
+)
+
+var unitProperties = []string{"LoadState", "ActiveState", "SubState", "Result", "NRestarts"}
+
+type SystemdPlugin struct {
+	name        string
+	commandHelp map[string]plugin.Command
+	config      PluginConfig
+
+	mu       sync.Mutex // guards restarts
+	restarts map[string]uint64
+}
+
+func NewPlugin(cfg config.Config) plugin.Plugin {
+	var pluginConfig PluginConfig
+	if err := plugin.DecodeConfig(cfg, "systemd", &pluginConfig); err != nil {
+		logger.Logger.Error("Error decoding systemd plugin config", "error", err)
+	}
+	if pluginConfig.Systemctl == "" {
+		pluginConfig.Systemctl = "systemctl"
+	}
+	if pluginConfig.Journalctl == "" {
+		pluginConfig.Journalctl = "journalctl"
+	}
+	if pluginConfig.JournalWindow <= 0 {
+		pluginConfig.JournalWindow = DefaultJournalWindow
+	}
+
+	return &SystemdPlugin{
+		name: "systemd",
+		commandHelp: map[string]plugin.Command{
+			"unit_status": {Description: "Show the state of the configured systemd units", Args: []plugin.Arg{
+				{Name: "unit", Type: plugin.ArgString, Description: "Only show this unit"},
+			}},
+			"unit_journal": {Description: "Show the recent journal of a systemd unit", Args: []plugin.Arg{
+				{Name: "unit", Type: plugin.ArgString, Required: true, Description: "Name of the unit"},
+				{Name: "window", Type: plugin.ArgDuration, Default: "1h", Description: "How far back to go"},
+			}},
+			"diagnostic_dump": {Description: "Dump systemctl status and journal of the configured units", Args: []plugin.Arg{plugin.DumpDirArg}},
+		},
+		config:   pluginConfig,
+		restarts: make(map[string]uint64),
+	}
+}
+
+func (sp *SystemdPlugin) Name() string {
+	return sp.name
+}
+
+func (sp *SystemdPlugin) CommandHelp() map[string]plugin.Command {
+	return sp.commandHelp
+}
+
+// run returns the output of the command, also when it exits non zero with
+// some output, like systemctl status does for inactive units.
+func run(name string, args ...string) ([]byte, error) {
+	out, err := exec.Command(name, args...).Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(out) > 0 {
+		return out, nil
+	}
+	return out, err
+}
+
+type unitState map[string]string
+
+func (sp *SystemdPlugin) show(unit string) (unitState, error) {
+	out, err := run(sp.config.Systemctl, "show", unit, "--property="+strings.Join(unitProperties, ","))
+	if err != nil {
+		return nil, err
+	}
+	state := make(unitState)
+	for _, line := range strings.Split(string(out), "\n") {
+		if key, value, found := strings.Cut(line, "="); found {
+			state[key] = value
+		}
+	}
+	return state, nil
+}
+
+func (state unitState) String() string {
+	return fmt.Sprintf("load=%s active=%s sub=%s result=%s restarts=%s",
+		state["LoadState"], state["ActiveState"], state["SubState"], state["Result"], state["NRestarts"])
+}
+
+// unitHealth evaluates a unit, flagging a restart since the previous check
+func (sp *SystemdPlugin) unitHealth(unit string) common.HealthStatus {
+	state, err := sp.show(unit)
+	if err != nil {
+		return common.HealthERROR(fmt.Sprintf("%s: %s", unit, err))
+	}
+	detail := fmt.Sprintf("%s: %s", unit, state)
+
+	restarts, _ := strconv.ParseUint(state["NRestarts"], 10, 64)
+	sp.mu.Lock()
+	previous, seen := sp.restarts[unit]
+	sp.restarts[unit] = restarts
+	sp.mu.Unlock()
+
+	switch {
+	case state["LoadState"] != "loaded":
+		return common.HealthWARN(detail)
+	case state["ActiveState"] == "failed":
+		return common.HealthFAIL(detail)
+	case state["ActiveState"] != "active":
+		return common.HealthWARN(detail)
+	case seen && restarts > previous:
+		return common.HealthWARN(fmt.Sprintf("%s, restarted %d times since last check", detail, restarts-previous))
+	default:
+		return common.HealthOK(detail)
+	}
+}
+
+func (sp *SystemdPlugin) HealthCheck() common.HealthStatus {
+	if len(sp.config.Units) == 0 {
+		return common.HealthWARN("No systemd units configured")
+	}
+
+	worst := common.HealthOK("")
+	details := make([]string, 0, len(sp.config.Units))
+	for _, unit := range sp.config.Units {
+		status := sp.unitHealth(unit)
+		if common.WorseState(worst.State, status.State) != worst.State {
+			worst = status
+		}
+		details = append(details, status.Detail)
+	}
+	worst.Detail = strings.Join(details, "; ")
+	return worst
+}
+
+func (sp *SystemdPlugin) journal(unit string, since time.Time, until time.Time, extra ...string) ([]byte, error) {
+	args := []string{"--unit", unit, "--no-pager", "--output", "short-precise",
+		"--since", fmt.Sprintf("@%d", since.Unix()), "--until", fmt.Sprintf("@%d", until.Unix())}
+	return run(sp.config.Journalctl, append(args, extra...)...)
+}
+
+// writeOutput writes the command output to the dump, followed by the error if
+// the command failed.
+func writeOutput(path string, out []byte, err error) {
+	if err != nil {
+		out = append(out, []byte(fmt.Sprintf("error: %s\n", err))...)
+	}
+	if err := os.WriteFile(path, out, 0644); err != nil {
+		logger.Logger.Error("Error writing dump file", "file", path, "error", err)
+	}
+}
+
+func (sp *SystemdPlugin) diagnosticDump(dumpDir string) (string, error) {
+	systemdDir := filepath.Join(dumpDir, "systemd")
+	if err := os.MkdirAll(systemdDir, 0755); err != nil {
+		return "", err
+	}
+
+	until := time.Now()
+	since := until.Add(-time.Duration(sp.config.JournalWindow) * time.Second)
+	for _, unit := range sp.config.Units {
+		out, err := run(sp.config.Systemctl, "status", unit, "--no-pager", "--full", "--lines=0")
+		writeOutput(filepath.Join(systemdDir, unit+".status"), out, err)
+
+		out, err = sp.journal(unit, since, until)
+		writeOutput(filepath.Join(systemdDir, unit+".journal"), out, err)
+	}
+	return fmt.Sprintf("systemd: dumped %d units", len(sp.config.Units)), nil
+}
+
+func (sp *SystemdPlugin) Execute(command string, args ...string) (string, error) {
+	switch command {
+	case "unit_status":
+		units := sp.config.Units
+		if len(args) > 0 {
+			units = []string{args[0]}
+		}
+		lines := make([]string, 0, len(units))
+		for _, unit := range units {
+			state, err := sp.show(unit)
+			if err != nil {
+				lines = append(lines, fmt.Sprintf("%s: %s", unit, err))
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("%s: %s", unit, state))
+		}
+		return strings.Join(lines, "\n"), nil
+	case "unit_journal":
+		window, err := time.ParseDuration(args[1])
+		if err != nil {
+			return "", err
+		}
+		until := time.Now()
+		out, err := sp.journal(args[0], until.Add(-window), until, "--lines", commandJournalLines)
+		return string(out), err
+	case "diagnostic_dump":
+		if len(args) < 1 {
+			return "", fmt.Errorf("no diagnostic directory provided")
+		}
+		return sp.diagnosticDump(args[0])
+	default:
+		return "", fmt.Errorf("command not implemented")
+	}
+}
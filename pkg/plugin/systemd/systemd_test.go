@@ -0,0 +1,151 @@
+package systemd
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gitlab.cern.ch/eos/argeos/config"
+	"gitlab.cern.ch/eos/argeos/internal/common"
+	"gitlab.cern.ch/eos/argeos/internal/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	os.Exit(m.Run())
+}
+
+// fakeSystemctl answers show and status for a few units. The restarts of
+// the flappy unit are read from a file, so that tests can bump them.
+const fakeSystemctl = `#!/bin/sh
+dir=$(dirname "$0")
+case "$1 $2" in
+"show good.service")
+	printf 'LoadState=loaded\nActiveState=active\nSubState=running\nResult=success\nNRestarts=0\n' ;;
+"show failed.service")
+	printf 'LoadState=loaded\nActiveState=failed\nSubState=failed\nResult=exit-code\nNRestarts=0\n' ;;
+"show inactive.service")
+	printf 'LoadState=loaded\nActiveState=inactive\nSubState=dead\nResult=success\nNRestarts=0\n' ;;
+"show missing.service")
+	printf 'LoadState=not-found\nActiveState=inactive\nSubState=dead\nResult=success\nNRestarts=0\n' ;;
+"show flappy.service")
+	printf 'LoadState=loaded\nActiveState=active\nSubState=running\nResult=success\nNRestarts=%s\n' "$(cat "$dir/restarts")" ;;
+"status "*)
+	echo "* $2 - stand-in unit"
+	exit 3 ;;
+*)
+	exit 1 ;;
+esac
+`
+
+// fakeJournalctl prints its arguments, to check what the plugin asked for
+const fakeJournalctl = `#!/bin/sh
+echo "journal $*"
+`
+
+func writeExecutable(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestPlugin(t *testing.T, units ...string) (*SystemdPlugin, string) {
+	t.Helper()
+	dir := t.TempDir()
+	systemctl := filepath.Join(dir, "systemctl")
+	journalctl := filepath.Join(dir, "journalctl")
+	writeExecutable(t, systemctl, fakeSystemctl)
+	writeExecutable(t, journalctl, fakeJournalctl)
+	if err := os.WriteFile(filepath.Join(dir, "restarts"), []byte("0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.Configure([]byte(`{"plugins": {"systemd": {"units": ["` + strings.Join(units, `", "`) +
+		`"], "systemctl": "` + systemctl + `", "journalctl": "` + journalctl + `"}}}`))
+	return NewPlugin(cfg).(*SystemdPlugin), dir
+}
+
+func TestHealthCheck(t *testing.T) {
+	tests := []struct {
+		name  string
+		units []string
+		want  common.HealthState
+	}{
+		{"active", []string{"good.service"}, common.StateOK},
+		{"failed", []string{"good.service", "failed.service"}, common.StateFAIL},
+		{"inactive", []string{"inactive.service"}, common.StateWARN},
+		{"not loaded", []string{"missing.service"}, common.StateWARN},
+		{"systemctl error", []string{"unknown.service"}, common.StateERROR},
+		{"fail beats error", []string{"unknown.service", "failed.service"}, common.StateFAIL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sp, _ := newTestPlugin(t, tt.units...)
+			status := sp.HealthCheck()
+			if status.State != tt.want {
+				t.Errorf("got %s (%s), want %s", status.StateString, status.Detail, common.HealthStateString(tt.want))
+			}
+		})
+	}
+}
+
+func TestHealthCheckRestarts(t *testing.T) {
+	sp, dir := newTestPlugin(t, "flappy.service")
+	if status := sp.HealthCheck(); status.State != common.StateOK {
+		t.Fatalf("first check: got %s (%s)", status.StateString, status.Detail)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "restarts"), []byte("2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	status := sp.HealthCheck()
+	if status.State != common.StateWARN || !strings.Contains(status.Detail, "restarted 2 times") {
+		t.Errorf("after restarts: got %s (%s)", status.StateString, status.Detail)
+	}
+	if status := sp.HealthCheck(); status.State != common.StateOK {
+		t.Errorf("without new restarts: got %s (%s)", status.StateString, status.Detail)
+	}
+}
+
+func TestDiagnosticDump(t *testing.T) {
+	sp, _ := newTestPlugin(t, "good.service")
+	dumpDir := t.TempDir()
+	out, err := sp.Execute("diagnostic_dump", dumpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "systemd: dumped 1 units" {
+		t.Errorf("unexpected summary %q", out)
+	}
+
+	status, err := os.ReadFile(filepath.Join(dumpDir, "systemd", "good.service.status"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(status), "stand-in unit") {
+		t.Errorf("status of an exited systemctl not kept: %q", status)
+	}
+	journal, err := os.ReadFile(filepath.Join(dumpDir, "systemd", "good.service.journal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(journal), "--unit good.service") || !strings.Contains(string(journal), "--since @") {
+		t.Errorf("unexpected journalctl arguments: %q", journal)
+	}
+}
+
+func TestUnitStatus(t *testing.T) {
+	sp, _ := newTestPlugin(t, "good.service", "failed.service")
+	out, err := sp.Execute("unit_status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "good.service: load=loaded active=active sub=running result=success restarts=0\n" +
+		"failed.service: load=loaded active=failed sub=failed result=exit-code restarts=0"
+	if out != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+}